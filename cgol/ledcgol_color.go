@@ -3,6 +3,13 @@ package main
 import (
 	"flag"
 	"fmt"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/compositor"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/config"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/health"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/mqtt"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/overlay"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/panel"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/text"
 	"image/color"
 	"image/png"
 	"io/ioutil"
@@ -10,16 +17,13 @@ import (
 	"math/rand"
 	"os"
 	"simonwaldherr.de/go/golibs/gcurses"
-	rgbmatrix "simonwaldherr.de/go/rpirgbled"
+	"strings"
 	"time"
 )
 
-var (
-	rows       = flag.Int("led-rows", 32, "number of rows supported")
-	parallel   = flag.Int("led-parallel", 1, "number of daisy-chained panels")
-	chain      = flag.Int("led-chain", 16, "number of displays daisy-chained")
-	brightness = flag.Int("brightness", 99, "brightness (0-100)")
-)
+var hardware = config.MatrixFlags(flag.CommandLine)
+var settings = panel.Flags(flag.CommandLine)
+var broker = mqtt.Flags(flag.CommandLine, "cgol")
 
 type Cell struct {
 	col color.RGBA
@@ -43,11 +47,19 @@ var (
 	setfilename  string
 	outputfile   string
 	port         string
+	setgoodbye   string
+	setgoodbyet  time.Duration
+	sethealth    string
+	setstale     time.Duration
+	setfifo      string
+	setstdin     bool
+	setovertime  time.Duration
+	setstatus    string
 )
 
 func fatal(err error) {
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
 	}
 }
 
@@ -148,8 +160,12 @@ func loadFirstRound(width, height int, filename string) *Field {
 			return generateFirstRound(width, height)
 		} else {
 			field := newField(width, height)
-			if filename[len(filename)-3:len(filename)] == "txt" {
-				gofile, _ := ioutil.ReadFile(filename)
+			if strings.HasSuffix(filename, "txt") {
+				gofile, err := ioutil.ReadFile(filename)
+				if err != nil {
+					log.Printf("%v, using a random seed", err)
+					return generateFirstRound(width, height)
+				}
 				output := []rune(string(gofile))
 				x := 0
 				y := 0
@@ -186,22 +202,27 @@ func loadFirstRound(width, height int, filename string) *Field {
 					}
 					x++
 				}
-			} else if filename[len(filename)-3:len(filename)] == "png" {
-				file, _ := os.Open(filename)
+			} else if strings.HasSuffix(filename, "png") {
+				file, err := os.Open(filename)
+				if err != nil {
+					log.Printf("%v, using a random seed", err)
+					return generateFirstRound(width, height)
+				}
 				defer file.Close()
 
-				img, _ := png.Decode(file)
+				img, err := png.Decode(file)
+				if err != nil {
+					log.Printf("%s: %v, using a random seed", filename, err)
+					return generateFirstRound(width, height)
+				}
 
 				for y := 0; y < 127; y++ {
 					for x := 0; x < 127; x++ {
-						oldPixel := img.At(x, y)
-						r, g, b, _ := oldPixel.RGBA()
+						col := panel.Color(img.At(x, y), color.RGBA{0, 0, 0, 255})
 
-						col := color.RGBA{uint8(r), uint8(g), uint8(b), 255}
-
-						if r > 128 || g > 128 || b > 128 {
+						if col.R > 128 || col.G > 128 || col.B > 128 {
 							field.setVitality(x, y, 9, col)
-						} else if r > 16 || g > 16 || b > 16 {
+						} else if col.R > 16 || col.G > 16 || col.B > 16 {
 							field.setVitality(x, y, 1, col)
 						}
 					}
@@ -233,90 +254,38 @@ func smallRandomUint() uint8 {
 	return 254
 }
 
-func newXY(x, y int) (int, int) {
-	var xh, yh int
-	y1 := y
-	x1 := x
-	if y < 64 {
-		yh = y
-		if x < 32 {
-			xh = x
-			x1 = 192 + yh
-			y1 = 31 - xh
-		} else if x < 64 {
-			xh = x - 32
-			x1 = 191 - yh
-			y1 = xh
-		} else if x < 96 {
-			xh = x - 64
-			x1 = 64 + yh
-			y1 = 31 - xh
-		} else if x < 128 {
-			xh = x - 96
-			x1 = 63 - yh
-			y1 = xh
-		} else if x < 192 {
-			x1 = 0
-			y1 = 0
-		}
-	} else if y < 128 {
-		yh = y - 64
-		if x < 32 {
-			xh = x
-			x1 = 256 + yh
-			y1 = 31 - xh
-		} else if x < 64 {
-			xh = x - 32
-			x1 = 383 - yh
-			y1 = xh
-		} else if x < 96 {
-			xh = x - 64
-			x1 = 384 + yh
-			y1 = 31 - xh
-		} else if x < 128 {
-			xh = x - 96
-			x1 = 511 - yh
-			y1 = xh
-		} else if x < 192 {
-			x1 = 0
-			y1 = 0
-		}
-	} else {
-		x1 = 0
-		y1 = 0
-	}
-	return x1, y1
-}
-
-func (field *Field) printField() string {
+func (field *Field) printField() error {
 	for y := 0; y < field.height; y++ {
 		for x := 0; x < field.width; x++ {
 			r := randomUint()
 			g := randomUint()
 			b := randomUint()
 
-			x1, y1 := newXY(x, y)
-
 			cell := field.getVitality(x, y)
 
 			if cell.vit > 0 {
 
 				if cell.vit > 3 {
-					c.Set(x1, y1, color.RGBA{cell.col.R, cell.col.G, cell.col.B, 255})
+					out.Set(x, y, color.RGBA{cell.col.R, cell.col.G, cell.col.B, 255})
 				} else {
-					c.Set(x1, y1, color.RGBA{r, g, b, 255})
+					out.Set(x, y, color.RGBA{r, g, b, 255})
 				}
 			} else {
 
 			}
 		}
 	}
-	c.Render()
-	return ""
+	reload()
+	return out.Render()
 }
 
-var config = &rgbmatrix.DefaultConfig
-var c *rgbmatrix.Canvas
+var reloader *config.Reloader
+var remote *mqtt.Client
+var out *panel.Output
+var panels *panel.Panels
+var monitor *health.Monitor
+var messages *overlay.Overlay
+var layers *compositor.Compositor
 
 func main() {
 	writer := gcurses.New()
@@ -328,39 +297,123 @@ func main() {
 	flag.IntVar(&setfps, "f", 20, "frames per second")
 	flag.StringVar(&setfilename, "o", "", "open file")
 	flag.IntVar(&outputlength, "l", 200, "frames")
+	flag.StringVar(&setgoodbye, "goodbye", "", "image shown when stopped with SIGINT or SIGTERM, empty for black")
+	flag.DurationVar(&setgoodbyet, "goodbye-time", 2*time.Second, "how long the goodbye image is shown")
+	flag.StringVar(&sethealth, "health", "", "address for the /healthz and /metrics endpoints, e.g. localhost:9100")
+	flag.DurationVar(&setstale, "health-stale", 30*time.Second, "time without a rendered frame after which the program counts as hung")
+	flag.StringVar(&setfifo, "fifo", "", "named pipe for text, color, image and clear commands, e.g. /run/ledmatrix.fifo")
+	flag.BoolVar(&setstdin, "stdin", false, "read overlay commands from stdin")
+	flag.DurationVar(&setovertime, "overlay-timeout", 0, "hide overlay messages after this time, 0 keeps them")
+	flag.StringVar(&setstatus, "statusbar", "", "show the time in a bar at the top or bottom, optionally with a layout like bottom:15:04:05")
+
+	fatal(config.Parse("cgol"))
+	reloader = config.Watch()
+
+	var err error
+	panels, err = panel.NewPanels(hardware, settings)
+	fatal(err)
+	goodbye, err := panel.LoadGoodbye(setgoodbye, setgoodbyet)
+	fatal(err)
+	panel.HandleSignals(goodbye, func() { remote.Close() })
+	monitor = health.New(setstale)
+	panels.Monitor = monitor
+	monitor.Gauge("ledmatrix_brightness_percent", "Brightness after dimming.", func() float64 { return float64(panels.Dimmer.Level()) })
+	if sethealth != "" {
+		monitor.Serve(sethealth)
+	}
+	monitor.Watchdog()
+	messages = overlay.New(text.Face7x13, setovertime)
+	if setfifo != "" {
+		fatal(messages.ListenFIFO(setfifo))
+	}
+	if setstdin {
+		go messages.Listen(os.Stdin)
+	}
+	layers = compositor.New()
+	layers.Add(compositor.NewLayer("messages", 20, messages))
+	status, err := compositor.ParseStatusBar(setstatus, text.Face7x13)
+	fatal(err)
+	if status != nil {
+		layers.Add(compositor.NewLayer("status", 10, status))
+	}
 
-	flag.Parse()
-
-	config.Rows = *rows
-	config.ChainLength = *chain
-	config.Parallel = *parallel
-	config.PWMBits = 6
-	config.PWMLSBNanoseconds = 95
-	config.Brightness = *brightness
-	config.ScanMode = rgbmatrix.Interlaced
-	config.DisableHardwarePulsing = false
-
-	for {
-		m, err := rgbmatrix.NewRGBLedMatrix(config)
-		fatal(err)
-		c = rgbmatrix.NewCanvas(m)
-		if setfilename != "" {
-			log.Println("set via file")
-			field = loadFirstRound(setwidth, setheight, setfilename)
-			log.Println("file loaded")
-		} else {
-			log.Println("random seed")
-			field = generateFirstRound(setwidth, setheight)
-			log.Println("random seed generated")
+	if broker.Broker != "" {
+		remote = mqtt.Connect(*broker, mqtt.Handlers{
+			Level:   func(level int) { panels.Dimmer.Override(level, 0) },
+			Release: func() { panels.Dimmer.ClearOverride() },
+			Scene:   reloader.SetScene,
+			Scenes:  reloader.Scenes,
+			Current: reloader.Scene,
+			Text:    func(s string) error { return messages.Exec("text " + s) },
+			Image:   func(path string) error { return messages.Exec("image " + path) },
+		})
+	}
+
+	panel.Supervise("game of life", func() error {
+		for {
+			if err := play(); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// play runs one game on freshly opened panels.
+func play() error {
+	var err error
+	if out, err = panels.Open(); err != nil {
+		return err
+	}
+	defer out.Close()
+	out.Overlay = layers
+	if setfilename != "" {
+		log.Println("set via file")
+		field = loadFirstRound(setwidth, setheight, setfilename)
+		log.Println("file loaded")
+	} else {
+		log.Println("random seed")
+		field = generateFirstRound(setwidth, setheight)
+		log.Println("random seed generated")
+	}
+	if err := field.printField(); err != nil {
+		return err
+	}
+	time.Sleep(3 * time.Second)
+
+	for i := 0; i != setduration; i++ {
+		field = field.nextRound()
+		time.Sleep(time.Millisecond * 3)
+		if err := field.printField(); err != nil {
+			return err
 		}
-		field.printField()
-		time.Sleep(3 * time.Second)
+	}
+	return nil
+}
 
-		for i := 0; i != setduration; i++ {
-			field = field.nextRound()
-			time.Sleep(time.Millisecond * 3)
-			field.printField()
+// reload applies changed settings between two frames. The panels are
+// only opened again for new hardware settings, everything else changes
+// in place. Broken settings are logged and the old ones stay in effect.
+func reload() {
+	changed := reloader.Reload()
+	if changed == nil {
+		return
+	}
+	panels.Reload(changed)
+	if changed.Scenes {
+		remote.Announce()
+	}
+
+	if changed.Has("overlay-timeout") {
+		messages.SetTimeout(setovertime)
+	}
+	if changed.Has("statusbar") {
+		if status, err := compositor.ParseStatusBar(setstatus, text.Face7x13); err != nil {
+			log.Printf("reload: %v", err)
+		} else {
+			layers.Remove("status")
+			if status != nil {
+				layers.Add(compositor.NewLayer("status", 10, status))
+			}
 		}
-		c.Close()
 	}
 }
@@ -5,31 +5,30 @@ import (
 	"image"
 	"image/color"
 	"image/draw"
+	"log"
 	"math"
 	"math/rand"
+	"os"
+	"strings"
 	"time"
+	_ "time/tzdata" // DST rules even without zoneinfo on the Pi
 
 	"golang.org/x/image/font"
-	"golang.org/x/image/font/basicfont"
-	"golang.org/x/image/math/fixed"
 
-	rgbmatrix "simonwaldherr.de/go/rpirgbled"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/config"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/fahrplan"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/gfx"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/health"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/mqtt"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/overlay"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/panel"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/scale"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/text"
 )
 
-var (
-	rows       = flag.Int("led-rows", 32, "number of rows supported")
-	parallel   = flag.Int("led-parallel", 1, "number of daisy-chained panels")
-	chain      = flag.Int("led-chain", 16, "number of displays daisy-chained")
-	brightness = flag.Int("brightness", 99, "brightness (0-100)")
-)
-
-type Field struct {
-	cells  [][]int
-	width  int
-	height int
-}
-
-var field *Field
+var hardware = config.MatrixFlags(flag.CommandLine)
+var settings = panel.Flags(flag.CommandLine)
+var broker = mqtt.Flags(flag.CommandLine, "clock")
 
 var (
 	setfps       int
@@ -40,24 +39,48 @@ var (
 	setfilename  string
 	outputfile   string
 	port         string
+	setgoodbye   string
+	setgoodbyet  time.Duration
+	sethealth    string
+	setstale     time.Duration
+	setfifo      string
+	setstdin     bool
+	setovertime  time.Duration
+	setface      string
+	setfg        string
+	setaccent    string
+	setdim       string
+	settext      string
+	settz        string
+	setzones     string
+	setworld     string
+	setutc       bool
+	setfahrplan  string
+	setrooms     string
+	settarget    string
+	setfinale    string
+	setfinaletxt string
+	setfinaledur time.Duration
+	setfont      string
+	setfontsize  float64
 )
 
 func fatal(err error) {
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
 	}
 }
 
-func newField(width, height int) *Field {
-	cells := make([][]int, height)
-	for cols := range cells {
-		cells[cols] = make([]int, width)
-	}
-	return &Field{cells: cells, width: width, height: height}
-}
-
-var config = &rgbmatrix.DefaultConfig
-var c *rgbmatrix.Canvas
+var out *panel.Output
+var pacer *time.Ticker
+var panels *panel.Panels
+var monitor *health.Monitor
+var messages *overlay.Overlay
+var clockface Face
+var reloader *config.Reloader
+var remote *mqtt.Client
+var location = time.Local
+var labelFace font.Face = text.Face7x13
 
 func randomUint() uint8 {
 	return uint8(rand.Intn(255))
@@ -73,239 +96,212 @@ func genClock() *image.RGBA {
 
 	draw.Draw(img, img.Bounds(), &image.Uniform{color.Black}, image.ZP, draw.Src)
 
-	now := time.Now()
-	hour, min, sec := now.Clock()
-	dateStr := now.Format("02.01.2006")
-	timeStr := now.Format("15:04:05")
-
-	drawHand(img, size/2, size/2, int(float64(hour)/12*360), size/3, color.RGBA{200, 200, 200, 200}, 3)   // Stundenzeiger
-	drawHand(img, size/2, size/2, int(float64(min)/60*360), size/2-10, color.RGBA{200, 200, 200, 200}, 2) // Minutenzeiger
-	drawHand(img, size/2, size/2, int(float64(sec)/60*360), size/2-5, color.RGBA{200, 0, 0, 200}, 1)      // Sekundenzeiger, rot
-
-	for i := 0; i < 12; i++ {
-		angle := float64(i) / 12 * 2 * math.Pi
-		x1 := size/2 + int(math.Cos(angle)*(float64(size)/2-1))
-		y1 := size/2 + int(math.Sin(angle)*(float64(size)/2-1))
-		x2 := size/2 + int(math.Cos(angle)*(float64(size)/2-10))
-		y2 := size/2 + int(math.Sin(angle)*(float64(size)/2-10))
-		drawLine(img, x1, y1, x2, y2, color.RGBA{200, 200, 200, 200})
-	}
-
-	addLabel(img, size/2, 100, dateStr)
-	addLabel(img, size/2, 115, timeStr)
+	clockface.Draw(img, time.Now().In(location))
 
 	return img
 }
 
-func drawHand(img *image.RGBA, x, y, angle, length int, col color.Color, width int) {
-	rad := float64(angle-90) * math.Pi / 180
+// drawHand zeichnet einen Zeiger, angle in Grad im Uhrzeigersinn ab 12 Uhr
+func drawHand(img *image.RGBA, x, y, angle, length float64, col color.Color, width float64) {
+	rad := (angle - 90) * math.Pi / 180
 
-	endX := x + int(float64(length)*math.Cos(rad))
-	endY := y + int(float64(length)*math.Sin(rad))
+	endX := x + length*math.Cos(rad)
+	endY := y + length*math.Sin(rad)
 
-	drawThickLine(img, x, y, endX, endY, col, width)
+	gfx.ThickLine(img, x, y, endX, endY, col, width)
 }
 
-// drawLine zeichnet eine einfache Linie von (x1, y1) zu (x2, y2)
-func drawLine(img *image.RGBA, x1, y1, x2, y2 int, col color.Color) {
-	dx := math.Abs(float64(x2 - x1))
-	dy := math.Abs(float64(y2 - y1))
-	sx := -1.0
-	sy := -1.0
-	if x1 < x2 {
-		sx = 1.0
-	}
-	if y1 < y2 {
-		sy = 1.0
-	}
-	err := dx - dy
+// drawText schreibt label linksbündig ab x mit der Grundlinie bei y
+func drawText(img *image.RGBA, x, y int, label string, col color.Color) {
+	text.Draw(img, labelFace, x, y, label, col, text.Left)
+}
 
-	for {
-		img.Set(int(x1), int(y1), col)
-		if x1 == x2 && y1 == y2 {
-			break
-		}
-		e2 := 2 * err
-		if e2 > -dy {
-			err -= dy
-			x1 += int(sx)
-		}
-		if e2 < dx {
-			err += dx
-			y1 += int(sy)
-		}
-	}
+// addLabel schreibt label zentriert um x
+func addLabel(img *image.RGBA, x, y int, label string, col color.Color) {
+	text.Draw(img, labelFace, x, y, label, col, text.Center)
 }
 
-func drawThickLine(img *image.RGBA, x1, y1, x2, y2 int, col color.Color, width int) {
-	if width <= 1 {
-		drawLine(img, x1, y1, x2, y2, col)
-		return
-	}
+// printField zeichnet ein Bild der Uhr
+func printField() error {
+	reload()
+	out.Draw(genClock())
+	return out.Render()
+}
 
-	offsets := make([]image.Point, 0, width*width)
-	for dy := -width / 2; dy <= width/2; dy++ {
-		for dx := -width / 2; dx <= width/2; dx++ {
-			offsets = append(offsets, image.Point{dx, dy})
-		}
+func main() {
+	flag.IntVar(&setwidth, "w", 80, "terminal width")
+	flag.IntVar(&setheight, "h", 20, "terminal height")
+	flag.IntVar(&setduration, "d", -1, "game of life duration")
+	flag.IntVar(&setfps, "f", 20, "frames per second")
+	flag.StringVar(&setfilename, "o", "./clock.png", "open file")
+
+	flag.IntVar(&outputlength, "l", 200, "frames")
+	flag.StringVar(&setgoodbye, "goodbye", "", "image shown when stopped with SIGINT or SIGTERM, empty for black")
+	flag.DurationVar(&setgoodbyet, "goodbye-time", 2*time.Second, "how long the goodbye image is shown")
+	flag.StringVar(&sethealth, "health", "", "address for the /healthz and /metrics endpoints, e.g. localhost:9100")
+	flag.DurationVar(&setstale, "health-stale", 30*time.Second, "time without a rendered frame after which the program counts as hung")
+	flag.StringVar(&setfifo, "fifo", "", "named pipe for text, color, image and clear commands, e.g. /run/ledmatrix.fifo")
+	flag.BoolVar(&setstdin, "stdin", false, "read overlay commands from stdin")
+	flag.DurationVar(&setovertime, "overlay-timeout", 0, "hide overlay messages after this time, 0 keeps them")
+
+	flag.StringVar(&setface, "face", "analog", "clock face: "+faceNames())
+	flag.StringVar(&setfg, "fg", "", "foreground color of the face (rrggbb), empty for the face default")
+	flag.StringVar(&setaccent, "accent", "", "accent color of the face (rrggbb)")
+	flag.StringVar(&setdim, "dim", "", "color of unlit segments, bits and letters (rrggbb)")
+	flag.StringVar(&settext, "text", "", "color of the date and time labels (rrggbb)")
+	flag.StringVar(&settz, "tz", "", "time zone of the clock, e.g. Europe/Berlin or UTC (default local)")
+	flag.StringVar(&setzones, "zones", "", "zones of the world clock, e.g. Berlin=Europe/Berlin,Tokyo=Asia/Tokyo")
+	flag.StringVar(&setworld, "world-style", "auto", "world clock layout: dials, rows or auto")
+	flag.BoolVar(&setutc, "utc", false, "add a UTC readout to the world clock")
+	flag.StringVar(&setfahrplan, "fahrplan", "", "Frab or Pretalx schedule (JSON or XML) for the fahrplan and countdown faces")
+	flag.StringVar(&setrooms, "rooms", "", "rooms shown by the fahrplan face, comma separated (default all)")
+	flag.StringVar(&settarget, "target", "midnight", "countdown target: midnight, next (talk), hh:mm, yyyy-mm-dd hh:mm or RFC 3339")
+	flag.StringVar(&setfinale, "finale", "fireworks", "animation when the countdown ends: fireworks, flash, text or none")
+	flag.StringVar(&setfinaletxt, "finale-text", "", "text shown by the finale (default the talk title)")
+	flag.DurationVar(&setfinaledur, "finale-time", time.Minute, "duration of the finale")
+	flag.StringVar(&setfont, "font", "7x13", "font of the labels: 7x13, 8x16 or a BDF, PCF, TTF or OTF file")
+	flag.Float64Var(&setfontsize, "font-size", 13, "size of TrueType and OpenType fonts in pixels")
+
+	fatal(config.Parse("clock"))
+	reloader = config.Watch()
+
+	var err error
+	panels, err = panel.NewPanels(hardware, settings)
+	fatal(err)
+	goodbye, err := panel.LoadGoodbye(setgoodbye, setgoodbyet)
+	fatal(err)
+	panel.HandleSignals(goodbye, func() { remote.Close() })
+	monitor = health.New(setstale)
+	panels.Monitor = monitor
+	monitor.Gauge("ledmatrix_brightness_percent", "Brightness after dimming.", func() float64 { return float64(panels.Dimmer.Level()) })
+	if sethealth != "" {
+		monitor.Serve(sethealth)
+	}
+	monitor.Watchdog()
+	fatal(loadFace())
+	messages = overlay.New(labelFace, setovertime)
+	if setfifo != "" {
+		fatal(messages.ListenFIFO(setfifo))
+	}
+	if setstdin {
+		go messages.Listen(os.Stdin)
 	}
 
-	for _, offset := range offsets {
-		drawLine(img, x1+offset.X, y1+offset.Y, x2+offset.X, y2+offset.Y, col)
+	if broker.Broker != "" {
+		remote = mqtt.Connect(*broker, mqtt.Handlers{
+			Level:   func(level int) { panels.Dimmer.Override(level, 0) },
+			Release: func() { panels.Dimmer.ClearOverride() },
+			Scene:   reloader.SetScene,
+			Scenes:  reloader.Scenes,
+			Current: reloader.Scene,
+			Text:    func(s string) error { return messages.Exec("text " + s) },
+			Image:   func(path string) error { return messages.Exec("image " + path) },
+		})
 	}
+
+	panel.Supervise("clock", matrix)
 }
 
-// drawCircle zeichnet einen Kreis mit Mittelpunkt (x, y) und Radius r
-func drawCircle(img *image.RGBA, x, y, r int, col color.Color) {
-	putPixel := func(xc, yc, x, y int) {
-		img.Set(xc+x, yc+y, col)
-		img.Set(xc-x, yc+y, col)
-		img.Set(xc+x, yc-y, col)
-		img.Set(xc-x, yc-y, col)
-		img.Set(xc+y, yc+x, col)
-		img.Set(xc-y, yc+x, col)
-		img.Set(xc+y, yc-x, col)
-		img.Set(xc-y, yc-x, col)
+// loadFace lädt Schrift und Zifferblatt nach den Einstellungen, bei einem
+// Fehler bleiben die bisherigen in Gebrauch
+func loadFace() error {
+	labels, err := text.Load(setfont, setfontsize)
+	if err != nil {
+		return err
 	}
-
-	x = 0
-	y = r
-	d := 3 - 2*r
-	putPixel(x, y, x, y)
-	for y >= x {
-		x++
-		if d > 0 {
-			y--
-			d = d + 4*(x-y) + 10
-		} else {
-			d = d + 4*x + 6
+	loc := time.Local
+	if settz != "" {
+		if loc, err = time.LoadLocation(settz); err != nil {
+			return err
 		}
-		putPixel(x, y, x, y)
 	}
-}
 
-func addLabel(img *image.RGBA, x, y int, label string) {
-	col := color.RGBA{255, 255, 255, 255} // Weiß
-	point := fixed.P(x-(len(label)*3), y) // Zentriert das Datum
-	d := &font.Drawer{
-		Dst:  img,
-		Src:  image.NewUniform(col),
-		Face: basicfont.Face7x13,
-		Dot:  point,
+	options := FaceOptions{
+		UTC:        setutc,
+		Style:      setworld,
+		Finale:     setfinale,
+		FinaleText: setfinaletxt,
+		FinaleTime: setfinaledur,
 	}
-	d.DrawString(label)
-}
-
-func newXY(x, y int) (int, int) {
-	var xh, yh int
-	y1 := y
-	x1 := x
-	if y < 64 {
-		yh = y
-		if x < 32 {
-			xh = x
-			x1 = 192 + yh
-			y1 = 31 - xh
-		} else if x < 64 {
-			xh = x - 32
-			x1 = 191 - yh
-			y1 = xh
-		} else if x < 96 {
-			xh = x - 64
-			x1 = 64 + yh
-			y1 = 31 - xh
-		} else if x < 128 {
-			xh = x - 96
-			x1 = 63 - yh
-			y1 = xh
-		} else if x < 192 {
-			x1 = 0
-			y1 = 0
+	for _, p := range []struct {
+		dst *color.RGBA
+		src string
+	}{{&options.Palette.Foreground, setfg}, {&options.Palette.Accent, setaccent}, {&options.Palette.Dim, setdim}, {&options.Palette.Text, settext}} {
+		if *p.dst, err = scale.ParseColor(p.src); err != nil {
+			return err
 		}
-	} else if y < 128 {
-		yh = y - 64
-		if x < 32 {
-			xh = x
-			x1 = 256 + yh
-			y1 = 31 - xh
-		} else if x < 64 {
-			xh = x - 32
-			x1 = 383 - yh
-			y1 = xh
-		} else if x < 96 {
-			xh = x - 64
-			x1 = 384 + yh
-			y1 = 31 - xh
-		} else if x < 128 {
-			xh = x - 96
-			x1 = 511 - yh
-			y1 = xh
-		} else if x < 192 {
-			x1 = 0
-			y1 = 0
+	}
+	if options.Zones, err = parseZones(setzones); err != nil {
+		return err
+	}
+	if setfahrplan != "" {
+		if options.Fahrplan, err = fahrplan.Load(setfahrplan); err != nil {
+			return err
 		}
-	} else {
-		x1 = 0
-		y1 = 0
 	}
-	return x1, y1
-}
+	for _, room := range strings.Split(setrooms, ",") {
+		if room = strings.TrimSpace(room); room != "" {
+			options.Rooms = append(options.Rooms, room)
+		}
+	}
+	if options.Target, err = parseTarget(settarget, loc); err != nil {
+		return err
+	}
+	face, err := newFace(setface, options)
+	if err != nil {
+		return err
+	}
 
-func (field *Field) printField() string {
-	img := genClock()
+	labelFace, location, clockface = labels, loc, face
+	if messages != nil {
+		messages.SetFace(labels)
+	}
+	return nil
+}
 
-	for y := 0; y < 128; y++ {
-		for x := 0; x < 128; x++ {
+// matrix öffnet die Panels und zeichnet die Uhr, bis ein Fehler auftritt
+func matrix() error {
+	var err error
+	if out, err = panels.Open(); err != nil {
+		return err
+	}
+	defer out.Close()
+	out.Overlay = messages
 
-			x1, y1 := newXY(x, y)
+	// render at a steady rate, so the second hand sweeps smoothly
+	pacer = time.NewTicker(time.Second / time.Duration(max(1, setfps)))
+	defer pacer.Stop()
 
-			oldPixel := img.At(x, y)
-			r, g, b, _ := oldPixel.RGBA()
-			c.Set(x1, y1, color.RGBA{uint8(r), uint8(g), uint8(b), 255})
+	for range pacer.C {
+		if err := printField(); err != nil {
+			return err
 		}
 	}
-	c.Render()
-	time.Sleep(time.Millisecond * 100)
-	return ""
+	return nil
 }
 
-func main() {
-	flag.IntVar(&setwidth, "w", 80, "terminal width")
-	flag.IntVar(&setheight, "h", 20, "terminal height")
-	flag.IntVar(&setduration, "d", -1, "game of life duration")
-	flag.IntVar(&setfps, "f", 20, "frames per second")
-	flag.StringVar(&setfilename, "o", "./clock.png", "open file")
-
-	flag.IntVar(&outputlength, "l", 200, "frames")
-
-	flag.Parse()
-	
-	for {
-		matrix()
+// reload übernimmt geänderte Einstellungen zwischen zwei Bildern, die
+// Panels werden nur für neue Hardware-Einstellungen neu geöffnet
+func reload() {
+	changed := reloader.Reload()
+	if changed == nil {
+		return
 	}
-}
-	
-func matrix() {
-	defer func() {
-		if err := recover(); err != nil {
-			matrix()
+	panels.Reload(changed)
+	if changed.Scenes {
+		remote.Announce()
 	}
-	}()
-	config.Rows = *rows
-	config.Parallel = *parallel
-	config.ChainLength = *chain
-	config.Brightness = *brightness
-
-	m, err := rgbmatrix.NewRGBLedMatrix(config)
-	fatal(err)
-	
-	defer m.Close()
 
-	c = rgbmatrix.NewCanvas(m)
-	defer c.Close()
-
-	for {
-		time.Sleep(time.Millisecond * 50)
-		field.printField()
+	if changed.Files("face", "fg", "accent", "dim", "text", "tz", "zones", "world-style", "utc",
+		"fahrplan", "rooms", "target", "finale", "finale-text", "finale-time", "font", "font-size") {
+		if err := loadFace(); err != nil {
+			log.Printf("reload: %v", err)
+		}
+	}
+	if changed.Has("overlay-timeout") {
+		messages.SetTimeout(setovertime)
+	}
+	if changed.Has("f") {
+		pacer.Reset(time.Second / time.Duration(max(1, setfps)))
 	}
 }
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"time"
+
+	"github.com/SimonWaldherr/RGB-LED-Matrix/gfx"
+)
+
+type analogFace struct {
+	Palette
+}
+
+func newAnalogFace(o FaceOptions) Face {
+	return &analogFace{o.Palette.withDefaults(Palette{
+		Foreground: color.RGBA{200, 200, 200, 255},
+		Accent:     color.RGBA{200, 0, 0, 255},
+		Text:       color.RGBA{255, 255, 255, 255},
+	})}
+}
+
+func (f *analogFace) Draw(img *image.RGBA, now time.Time) {
+	size := float64(img.Bounds().Dx())
+	center := size/2 - 0.5
+	hour, min, sec := now.Clock()
+	dateStr := now.Format("02.01.2006")
+	timeStr := now.Format("15:04:05")
+
+	// continuous positions, so every hand sweeps instead of jumping
+	seconds := float64(sec) + float64(now.Nanosecond())/1e9
+	minutes := float64(min) + seconds/60
+	hours := float64(hour%12) + minutes/60
+
+	for i := 0; i < 12; i++ {
+		angle := float64(i) / 12 * 2 * math.Pi
+		x1 := center + math.Cos(angle)*(size/2-1)
+		y1 := center + math.Sin(angle)*(size/2-1)
+		x2 := center + math.Cos(angle)*(size/2-10)
+		y2 := center + math.Sin(angle)*(size/2-10)
+		gfx.ThickLine(img, x1, y1, x2, y2, f.Foreground, 1)
+	}
+
+	drawHand(img, center, center, hours/12*360, size/3, f.Foreground, 3.5)      // Stundenzeiger
+	drawHand(img, center, center, minutes/60*360, size/2-10, f.Foreground, 2.5) // Minutenzeiger
+	drawHand(img, center, center, seconds/60*360, size/2-5, f.Accent, 1)        // Sekundenzeiger
+
+	addLabel(img, int(size)/2, 100, dateStr, f.Text)
+	addLabel(img, int(size)/2, 115, timeStr, f.Text)
+}
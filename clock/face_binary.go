@@ -0,0 +1,51 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"time"
+
+	"github.com/SimonWaldherr/RGB-LED-Matrix/gfx"
+)
+
+// binaryFace is a BCD clock, one column per decimal digit of hours,
+// minutes and seconds with the 8-4-2-1 bits from top to bottom.
+type binaryFace struct {
+	Palette
+}
+
+func newBinaryFace(o FaceOptions) Face {
+	return &binaryFace{o.Palette.withDefaults(Palette{
+		Foreground: color.RGBA{0, 160, 255, 255},
+		Accent:     color.RGBA{0, 220, 120, 255},
+		Dim:        color.RGBA{16, 16, 24, 255},
+		Text:       color.RGBA{200, 200, 200, 255},
+	})}
+}
+
+func (f *binaryFace) Draw(img *image.RGBA, now time.Time) {
+	hour, min, sec := now.Clock()
+	digits := [6]int{hour / 10, hour % 10, min / 10, min % 10, sec / 10, sec % 10}
+
+	// pairs of columns are grouped with a wider gap, the six columns are
+	// centered on the wall
+	const cell, gap, pair = 14, 4, 4
+	const left = (128 - (6*cell + 5*gap + 2*pair)) / 2
+	for col, d := range digits {
+		x := left + col*(cell+gap) + col/2*pair
+		on := f.Foreground
+		if col >= 4 {
+			on = f.Accent
+		}
+		for bit := 0; bit < 4; bit++ {
+			y := 12 + (3-bit)*(cell+gap)
+			c := f.Dim
+			if d&(1<<bit) != 0 {
+				c = on
+			}
+			gfx.FillRect(img, image.Rect(x, y, x+cell, y+cell), c)
+		}
+	}
+
+	addLabel(img, 64, 115, now.Format("15:04:05"), f.Text)
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/SimonWaldherr/RGB-LED-Matrix/fahrplan"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/gfx"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/text"
+)
+
+// Target is the moment a countdown runs to: a fixed moment, a time of
+// day or the start of the next talk in the Fahrplan.
+type Target struct {
+	At    time.Time
+	Daily time.Duration // since midnight, used if At is zero and Talk false
+	Talk  bool
+}
+
+// parseTarget parses "midnight", "next" (the next talk), a time of day
+// like "20:15" or a moment like "2024-12-31 23:59" or RFC 3339.
+func parseTarget(s string, loc *time.Location) (Target, error) {
+	switch s = strings.TrimSpace(s); strings.ToLower(s) {
+	case "", "midnight":
+		return Target{}, nil
+	case "next":
+		return Target{Talk: true}, nil
+	}
+	if t, err := time.Parse("15:04", s); err == nil {
+		return Target{Daily: time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", s, loc); err == nil {
+		return Target{At: t}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return Target{}, fmt.Errorf("countdown target %q: want midnight, next, hh:mm, yyyy-mm-dd hh:mm or RFC 3339", s)
+	}
+	return Target{At: t}, nil
+}
+
+// resolve returns the moment to count down to at now and a label for
+// it. A target stays current for the finale after it has passed, a
+// fixed moment stays current for good.
+func (t Target) resolve(now time.Time, fp *fahrplan.Fahrplan, finale time.Duration) (time.Time, string, bool) {
+	switch {
+	case !t.At.IsZero():
+		return t.At, "", true
+	case t.Talk:
+		if fp == nil {
+			return time.Time{}, "", false
+		}
+		talk, ok := fp.Next("", now.Add(-finale))
+		return talk.Start, talk.Title, ok
+	}
+	y, m, d := now.Date()
+	h, min := int(t.Daily/time.Hour), int(t.Daily%time.Hour/time.Minute)
+	at := time.Date(y, m, d, h, min, 0, 0, now.Location())
+	if !now.Before(at.Add(finale)) {
+		at = time.Date(y, m, d+1, h, min, 0, 0, now.Location())
+	}
+	return at, "", true
+}
+
+// countdownFace counts down to a target and plays a finale when it is
+// reached.
+type countdownFace struct {
+	Palette
+	fahrplan   *fahrplan.Fahrplan
+	target     Target
+	finale     string
+	finaleText string
+	finaleTime time.Duration
+}
+
+func newCountdownFace(o FaceOptions) Face {
+	f := &countdownFace{
+		Palette: o.Palette.withDefaults(Palette{
+			Foreground: color.RGBA{255, 160, 0, 255},
+			Accent:     color.RGBA{255, 40, 0, 255},
+			Dim:        color.RGBA{20, 12, 0, 255},
+			Text:       color.RGBA{200, 200, 200, 255},
+		}),
+		fahrplan:   o.Fahrplan,
+		target:     o.Target,
+		finale:     o.Finale,
+		finaleText: o.FinaleText,
+		finaleTime: o.FinaleTime,
+	}
+	if f.finaleTime <= 0 {
+		f.finaleTime = time.Minute
+	}
+	return f
+}
+
+func (f *countdownFace) Draw(img *image.RGBA, now time.Time) {
+	at, label, ok := f.target.resolve(now, f.fahrplan, f.finaleTime)
+	if !ok {
+		addLabel(img, 64, 68, "kein Termin", f.Text)
+		return
+	}
+	left := at.Sub(now)
+	if -left >= f.finaleTime {
+		// only a fixed moment stays in the past
+		addLabel(img, 64, 60, "vorbei", f.Accent)
+		addLabel(img, 64, 80, at.In(now.Location()).Format("02.01. 15:04"), f.Text)
+		return
+	}
+	if left <= 0 {
+		f.drawFinale(img, -left, label)
+		return
+	}
+
+	digits := &digitalFace{f.Palette}
+	secs := int(math.Ceil(left.Seconds()))
+	if secs <= 10 {
+		// the last seconds fill the wall
+		if secs == 10 {
+			digits.digit(img, 6, 14, 52, 100, 10, 1)
+			digits.digit(img, 70, 14, 52, 100, 10, 0)
+		} else {
+			digits.digit(img, 34, 14, 60, 100, 10, secs)
+		}
+		return
+	}
+
+	addLabel(img, 64, 13, fit(label, 124), f.Text)
+	days, hours, mins := secs/86400, secs/3600%24, secs/60%60
+	if days > 0 {
+		unit := "Tage"
+		if days == 1 {
+			unit = "Tag"
+		}
+		addLabel(img, 64, 29, fmt.Sprintf("%d %s", days, unit), f.Accent)
+	}
+	digits.digit(img, 4, 34, 24, 46, 4, hours/10)
+	digits.digit(img, 32, 34, 24, 46, 4, hours%10)
+	gfx.FillRect(img, image.Rect(62, 46, 66, 50), f.Accent)
+	gfx.FillRect(img, image.Rect(62, 66, 66, 70), f.Accent)
+	digits.digit(img, 72, 34, 24, 46, 4, mins/10)
+	digits.digit(img, 100, 34, 24, 46, 4, mins%10)
+	digits.digit(img, 49, 86, 12, 22, 2, secs%60/10)
+	digits.digit(img, 66, 86, 12, 22, 2, secs%60%10)
+	addLabel(img, 64, 124, at.In(now.Location()).Format("02.01. 15:04"), f.Text)
+}
+
+// drawFinale draws the finale animation since the target.
+func (f *countdownFace) drawFinale(img *image.RGBA, since time.Duration, label string) {
+	msg := f.finaleText
+	if msg == "" {
+		msg = label
+	}
+	t := since.Seconds()
+
+	switch f.finale {
+	case "none":
+	case "flash":
+		if int(t*4)%2 == 0 {
+			gfx.FillRect(img, img.Rect, f.Foreground)
+			addLabel(img, 64, 68, fit(msg, 124), color.RGBA{0, 0, 0, 255})
+			return
+		}
+	case "text":
+		if int(t*2)%2 == 0 {
+			return
+		}
+	default:
+		f.drawFireworks(img, t)
+	}
+	addLabel(img, 64, 68, fit(msg, 124), f.Text)
+}
+
+// drawFireworks draws a new rocket every 0.6 seconds, each bursting into
+// sparks that fall and fade for two seconds.
+func (f *countdownFace) drawFireworks(img *image.RGBA, t float64) {
+	const every, life = 0.6, 2.0
+	colors := []color.RGBA{f.Foreground, f.Accent, {255, 255, 255, 255}, {0, 160, 255, 255}, {0, 255, 80, 255}}
+	for i := int((t - life) / every); float64(i)*every <= t; i++ {
+		age := t - float64(i)*every
+		if i < 0 || age > life {
+			continue
+		}
+		rnd := rand.New(rand.NewSource(int64(i)))
+		cx, cy := 20+rnd.Float64()*88, 20+rnd.Float64()*50
+		col := colors[rnd.Intn(len(colors))]
+		fade := 1 - age/life
+		for s := 0; s < 28; s++ {
+			angle := float64(s)/28*2*math.Pi + rnd.Float64()*0.2
+			speed := 18 + rnd.Float64()*14
+			x := cx + math.Cos(angle)*speed*age
+			y := cy + math.Sin(angle)*speed*age + 9*age*age
+			gfx.Blend(img, int(x), int(y), col, fade)
+		}
+	}
+}
+
+// fahrplanFace shows the current and next talk of one room at a time,
+// switching rooms every eight seconds.
+type fahrplanFace struct {
+	Palette
+	fahrplan *fahrplan.Fahrplan
+	rooms    []string
+}
+
+func newFahrplanFace(o FaceOptions) Face {
+	f := &fahrplanFace{
+		Palette: o.Palette.withDefaults(Palette{
+			Foreground: color.RGBA{220, 220, 220, 255},
+			Accent:     color.RGBA{255, 160, 0, 255},
+			Dim:        color.RGBA{40, 40, 40, 255},
+			Text:       color.RGBA{120, 120, 120, 255},
+		}),
+		fahrplan: o.Fahrplan,
+		rooms:    o.Rooms,
+	}
+	if len(f.rooms) == 0 && f.fahrplan != nil {
+		f.rooms = f.fahrplan.Rooms()
+	}
+	return f
+}
+
+func (f *fahrplanFace) Draw(img *image.RGBA, now time.Time) {
+	addLabel(img, 64, 124, now.Format("15:04:05"), f.Text)
+	if f.fahrplan == nil || len(f.rooms) == 0 {
+		addLabel(img, 64, 60, "kein Fahrplan", f.Text)
+		return
+	}
+
+	page := int(now.Unix()/8) % len(f.rooms)
+	room := f.rooms[page]
+	drawText(img, 2, 11, fit(room, 124), f.Accent)
+	for i := range f.rooms {
+		dot := f.Dim
+		if i == page {
+			dot = f.Accent
+		}
+		gfx.FillRect(img, image.Rect(126-(len(f.rooms)-i)*4, 113, 128-(len(f.rooms)-i)*4, 115), dot)
+	}
+
+	if talk, ok := f.fahrplan.Current(room, now); ok {
+		for i, line := range wrap(talk.Title, 124, 3) {
+			drawText(img, 2, 28+i*12, line, f.Foreground)
+		}
+		// progress of the running talk
+		done := float64(now.Sub(talk.Start)) / float64(talk.Duration)
+		gfx.FillRect(img, image.Rect(2, 60, 126, 62), f.Dim)
+		gfx.FillRect(img, image.Rect(2, 60, 2+int(done*124), 62), f.Accent)
+	} else {
+		drawText(img, 2, 28, "Pause", f.Text)
+	}
+
+	talk, ok := f.fahrplan.Next(room, now)
+	if !ok {
+		drawText(img, 2, 78, "Ende", f.Text)
+		return
+	}
+	in := talk.Start.Sub(now).Round(time.Minute)
+	when := talk.Start.In(now.Location()).Format("15:04")
+	if in < time.Hour {
+		when += fmt.Sprintf(" in %d min", int(in.Minutes()))
+	} else if in >= 24*time.Hour {
+		when = talk.Start.In(now.Location()).Format("02.01. 15:04")
+	}
+	drawText(img, 2, 78, when, f.Accent)
+	for i, line := range wrap(talk.Title, 124, 2) {
+		drawText(img, 2, 92+i*12, line, f.Foreground)
+	}
+}
+
+// fit shortens s to width pixels in the label font.
+func fit(s string, width int) string {
+	if text.Measure(labelFace, s) <= width {
+		return s
+	}
+	r := []rune(s)
+	for len(r) > 0 && text.Measure(labelFace, string(r)+".") > width {
+		r = r[:len(r)-1]
+	}
+	return string(r) + "."
+}
+
+// wrap breaks s at spaces into at most lines lines of width pixels.
+func wrap(s string, width, lines int) []string {
+	var out []string
+	line := ""
+	for _, word := range strings.Fields(s) {
+		switch {
+		case line == "":
+			line = word
+		case text.Measure(labelFace, line+" "+word) <= width:
+			line += " " + word
+		default:
+			out = append(out, line)
+			line = word
+		}
+	}
+	if line != "" {
+		out = append(out, line)
+	}
+	if len(out) > lines {
+		out = out[:lines]
+		out[lines-1] += "..."
+	}
+	for i := range out {
+		out[i] = fit(out[i], width)
+	}
+	return out
+}
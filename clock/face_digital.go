@@ -0,0 +1,69 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"time"
+
+	"github.com/SimonWaldherr/RGB-LED-Matrix/gfx"
+)
+
+// segments of the digits 0-9, bit 0 is segment a (top) to bit 6 g
+// (middle), clockwise like on a data sheet
+var segments = [10]uint8{0x3f, 0x06, 0x5b, 0x4f, 0x66, 0x6d, 0x7d, 0x07, 0x7f, 0x6f}
+
+type digitalFace struct {
+	Palette
+}
+
+func newDigitalFace(o FaceOptions) Face {
+	return &digitalFace{o.Palette.withDefaults(Palette{
+		Foreground: color.RGBA{255, 40, 0, 255},
+		Accent:     color.RGBA{255, 40, 0, 255},
+		Dim:        color.RGBA{24, 4, 0, 255},
+		Text:       color.RGBA{200, 200, 200, 255},
+	})}
+}
+
+func (f *digitalFace) Draw(img *image.RGBA, now time.Time) {
+	hour, min, sec := now.Clock()
+
+	f.digit(img, 4, 18, 24, 46, 4, hour/10)
+	f.digit(img, 32, 18, 24, 46, 4, hour%10)
+	f.digit(img, 72, 18, 24, 46, 4, min/10)
+	f.digit(img, 100, 18, 24, 46, 4, min%10)
+
+	colon := f.Dim
+	if sec%2 == 0 {
+		colon = f.Accent
+	}
+	gfx.FillRect(img, image.Rect(62, 30, 66, 34), colon)
+	gfx.FillRect(img, image.Rect(62, 50, 66, 54), colon)
+
+	f.digit(img, 49, 74, 12, 22, 2, sec/10)
+	f.digit(img, 66, 74, 12, 22, 2, sec%10)
+
+	addLabel(img, 64, 118, now.Format("02.01.2006"), f.Text)
+}
+
+// digit draws a seven-segment digit into the w x h box at x, y with
+// segments t pixels thick.
+func (f *digitalFace) digit(img *image.RGBA, x, y, w, h, t, d int) {
+	mid := y + (h-t)/2
+	rects := [7]image.Rectangle{
+		image.Rect(x+t, y, x+w-t, y+t),       // a
+		image.Rect(x+w-t, y+t, x+w, mid),     // b
+		image.Rect(x+w-t, mid+t, x+w, y+h-t), // c
+		image.Rect(x+t, y+h-t, x+w-t, y+h),   // d
+		image.Rect(x, mid+t, x+t, y+h-t),     // e
+		image.Rect(x, y+t, x+t, mid),         // f
+		image.Rect(x+t, mid, x+w-t, mid+t),   // g
+	}
+	for i, r := range rects {
+		col := f.Dim
+		if segments[d]&(1<<i) != 0 {
+			col = f.Foreground
+		}
+		gfx.FillRect(img, r, col)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"time"
+
+	"github.com/SimonWaldherr/RGB-LED-Matrix/gfx"
+)
+
+// mengenlehreFace is the Berlin-Uhr: a blinking second lamp, then rows
+// for five hours, hours, five minutes and minutes.
+type mengenlehreFace struct {
+	Palette
+}
+
+func newMengenlehreFace(o FaceOptions) Face {
+	return &mengenlehreFace{o.Palette.withDefaults(Palette{
+		Foreground: color.RGBA{255, 190, 0, 255},
+		Accent:     color.RGBA{230, 0, 0, 255},
+		Dim:        color.RGBA{24, 18, 8, 255},
+		Text:       color.RGBA{200, 200, 200, 255},
+	})}
+}
+
+func (f *mengenlehreFace) Draw(img *image.RGBA, now time.Time) {
+	hour, min, sec := now.Clock()
+
+	second := f.Dim
+	if sec%2 == 0 {
+		second = f.Foreground
+	}
+	gfx.FillCircle(img, 64, 14, 11, second)
+
+	f.row(img, 30, 4, hour/5, func(int) color.RGBA { return f.Accent })
+	f.row(img, 50, 4, hour%5, func(int) color.RGBA { return f.Accent })
+	f.row(img, 70, 11, min/5, func(i int) color.RGBA {
+		// every quarter hour lamp is red
+		if i%3 == 2 {
+			return f.Accent
+		}
+		return f.Foreground
+	})
+	f.row(img, 90, 4, min%5, func(int) color.RGBA { return f.Foreground })
+
+	addLabel(img, 64, 124, now.Format("15:04:05"), f.Text)
+}
+
+// row draws n lamps across the width at y, the first lit of them on.
+func (f *mengenlehreFace) row(img *image.RGBA, y, n, lit int, on func(int) color.RGBA) {
+	const height, gap, margin = 16, 2, 3
+	w := (128 - 2*margin - (n-1)*gap) / n
+	x := (128 - n*w - (n-1)*gap) / 2
+	for i := 0; i < n; i++ {
+		c := f.Dim
+		if i < lit {
+			c = on(i)
+		}
+		gfx.FillRect(img, image.Rect(x, y, x+w, y+height), c)
+		x += w + gap
+	}
+}
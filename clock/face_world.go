@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/SimonWaldherr/RGB-LED-Matrix/gfx"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/text"
+)
+
+// Zone is a time zone shown by the world clock.
+type Zone struct {
+	Label    string
+	Location *time.Location
+}
+
+// parseZones parses a list like "Berlin=Europe/Berlin,America/New_York".
+// Without a label the city of the zone name is used.
+func parseZones(s string) ([]Zone, error) {
+	var zones []Zone
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		label, name, ok := strings.Cut(part, "=")
+		if !ok {
+			name = part
+			label = strings.ReplaceAll(path.Base(name), "_", " ")
+		}
+		loc, err := time.LoadLocation(strings.TrimSpace(name))
+		if err != nil {
+			return nil, fmt.Errorf("time zone %q: %v", name, err)
+		}
+		zones = append(zones, Zone{Label: strings.TrimSpace(label), Location: loc})
+	}
+	return zones, nil
+}
+
+// worldFace shows several time zones, as small analog dials for up to
+// four zones or as digital rows.
+type worldFace struct {
+	Palette
+	zones []Zone
+	dials bool
+}
+
+func newWorldFace(o FaceOptions) Face {
+	f := &worldFace{Palette: o.Palette.withDefaults(Palette{
+		Foreground: color.RGBA{200, 200, 200, 255},
+		Accent:     color.RGBA{200, 0, 0, 255},
+		Dim:        color.RGBA{10, 14, 30, 255},
+		Text:       color.RGBA{255, 255, 255, 255},
+	})}
+	f.zones = append(f.zones, o.Zones...)
+	if len(f.zones) == 0 {
+		f.zones = append(f.zones, Zone{Label: "Lokal", Location: time.Local})
+	}
+	if o.UTC {
+		f.zones = append(f.zones, Zone{Label: "UTC", Location: time.UTC})
+	}
+	switch o.Style {
+	case "dials":
+		f.dials = true
+	case "rows":
+	default:
+		f.dials = len(f.zones) <= 4
+	}
+	return f
+}
+
+func (f *worldFace) Draw(img *image.RGBA, now time.Time) {
+	if f.dials {
+		for i, z := range f.zones {
+			f.dial(img, (i%2)*64, (i/2)*64, z, now.In(z.Location))
+		}
+		return
+	}
+
+	// as many rows as fit, 16 pixels each
+	rows := min(len(f.zones), 8)
+	top := (128 - rows*16) / 2
+	for i, z := range f.zones[:rows] {
+		t := now.In(z.Location)
+		y := top + i*16 + 12
+		clock := t.Format("15:04")
+		col := f.Text
+		if !daytime(t) {
+			col = f.Foreground
+		}
+		drawText(img, 2, y, fit(z.Label, 120-text.Measure(labelFace, clock)), col)
+		text.Draw(img, labelFace, 126, y, clock, f.Accent, text.Right)
+	}
+}
+
+// dial draws a small analog clock with the label below into the 64x64
+// cell at x, y. The dial is lit during the day at that place.
+func (f *worldFace) dial(img *image.RGBA, x, y int, z Zone, t time.Time) {
+	cx, cy := float64(x)+31.5, float64(y)+25.5
+	const r = 22.0
+
+	if daytime(t) {
+		gfx.FillCircle(img, x+32, y+26, int(r), f.Dim)
+	}
+	for i := 0; i < 12; i++ {
+		angle := float64(i) / 12 * 2 * math.Pi
+		gfx.Blend(img, int(math.Round(cx+math.Cos(angle)*r)), int(math.Round(cy+math.Sin(angle)*r)), f.Foreground, 1)
+	}
+
+	seconds := float64(t.Second()) + float64(t.Nanosecond())/1e9
+	minutes := float64(t.Minute()) + seconds/60
+	hours := float64(t.Hour()%12) + minutes/60
+	drawHand(img, cx, cy, hours/12*360, r*0.55, f.Foreground, 2.5)
+	drawHand(img, cx, cy, minutes/60*360, r*0.85, f.Foreground, 1.5)
+	drawHand(img, cx, cy, seconds/60*360, r*0.9, f.Accent, 1)
+
+	addLabel(img, x+32, y+61, fit(z.Label, 62), f.Text)
+}
+
+func daytime(t time.Time) bool {
+	return t.Hour() >= 6 && t.Hour() < 18
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"time"
+
+	"github.com/SimonWaldherr/RGB-LED-Matrix/gfx"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/text"
+)
+
+// wordGrid is the letter matrix of the classic German word clock.
+var wordGrid = [10]string{
+	"ESKISTAFÜNF",
+	"ZEHNZWANZIG",
+	"DREIVIERTEL",
+	"VORFUNKNACH",
+	"HALBAELFÜNF",
+	"EINSXAMZWEI",
+	"DREIPMJVIER",
+	"SECHSNLACHT",
+	"SIEBENZWÖLF",
+	"ZEHNEUNKUHR",
+}
+
+// word is a run of letters in wordGrid.
+type word struct {
+	row, col, len int
+}
+
+var (
+	wEs      = word{0, 0, 2}
+	wIst     = word{0, 3, 3}
+	wFuenf   = word{0, 7, 4}
+	wZehn    = word{1, 0, 4}
+	wZwanzig = word{1, 4, 7}
+	wViertel = word{2, 4, 7}
+	wVor     = word{3, 0, 3}
+	wNach    = word{3, 7, 4}
+	wHalb    = word{4, 0, 4}
+	wUhr     = word{9, 8, 3}
+	wEin     = word{5, 0, 3}
+)
+
+// hourWords are the hours 0 (twelve) to 11
+var hourWords = [12]word{
+	{8, 6, 5}, // ZWÖLF
+	{5, 0, 4}, // EINS
+	{5, 7, 4}, // ZWEI
+	{6, 0, 4}, // DREI
+	{6, 7, 4}, // VIER
+	{4, 7, 4}, // FÜNF
+	{7, 0, 5}, // SECHS
+	{8, 0, 6}, // SIEBEN
+	{7, 7, 4}, // ACHT
+	{9, 3, 4}, // NEUN
+	{9, 0, 4}, // ZEHN
+	{4, 5, 3}, // ELF
+}
+
+type wordFace struct {
+	Palette
+}
+
+func newWordFace(o FaceOptions) Face {
+	return &wordFace{o.Palette.withDefaults(Palette{
+		Foreground: color.RGBA{255, 220, 160, 255},
+		Accent:     color.RGBA{255, 220, 160, 255},
+		Dim:        color.RGBA{20, 20, 20, 255},
+	})}
+}
+
+// words returns the lit words for the time, in steps of five minutes.
+func (f *wordFace) words(now time.Time) []word {
+	hour, min, _ := now.Clock()
+	lit := []word{wEs, wIst}
+	next := (hour + 1) % 12
+	hour %= 12
+
+	switch min / 5 {
+	case 0:
+		if hour == 1 {
+			// "es ist ein Uhr", not "eins Uhr"
+			return append(lit, wEin, wUhr)
+		}
+		return append(lit, hourWords[hour], wUhr)
+	case 1:
+		lit = append(lit, wFuenf, wNach, hourWords[hour])
+	case 2:
+		lit = append(lit, wZehn, wNach, hourWords[hour])
+	case 3:
+		lit = append(lit, wViertel, wNach, hourWords[hour])
+	case 4:
+		lit = append(lit, wZwanzig, wNach, hourWords[hour])
+	case 5:
+		lit = append(lit, wFuenf, wVor, wHalb, hourWords[next])
+	case 6:
+		lit = append(lit, wHalb, hourWords[next])
+	case 7:
+		lit = append(lit, wFuenf, wNach, wHalb, hourWords[next])
+	case 8:
+		lit = append(lit, wZwanzig, wVor, hourWords[next])
+	case 9:
+		lit = append(lit, wViertel, wVor, hourWords[next])
+	case 10:
+		lit = append(lit, wZehn, wVor, hourWords[next])
+	case 11:
+		lit = append(lit, wFuenf, wVor, hourWords[next])
+	}
+	return lit
+}
+
+func (f *wordFace) Draw(img *image.RGBA, now time.Time) {
+	const cellW, cellH, left, top = 11, 12, 3, 4
+
+	var on [10][11]bool
+	for _, w := range f.words(now) {
+		for i := 0; i < w.len; i++ {
+			on[w.row][w.col+i] = true
+		}
+	}
+
+	for row, line := range wordGrid {
+		for col, r := range []rune(line) {
+			c := f.Dim
+			if on[row][col] {
+				c = f.Foreground
+			}
+			text.Draw(img, text.Face7x13, left+col*cellW+cellW/2, top+row*cellH+10, string(r), c, text.Center)
+		}
+	}
+
+	// the minutes between the five minute steps as dots in the corners
+	corners := [4]image.Point{{0, 0}, {126, 0}, {126, 126}, {0, 126}}
+	for i := 0; i < now.Minute()%5; i++ {
+		p := corners[i]
+		gfx.FillRect(img, image.Rect(p.X, p.Y, p.X+2, p.Y+2), f.Accent)
+	}
+}
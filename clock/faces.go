@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SimonWaldherr/RGB-LED-Matrix/fahrplan"
+)
+
+// Face draws a clock face for the given time onto a black image.
+type Face interface {
+	Draw(img *image.RGBA, now time.Time)
+}
+
+// FaceOptions configures a face. Faces ignore what doesn't apply to
+// them.
+type FaceOptions struct {
+	Palette Palette
+	// Zones are shown by the world clock, UTC adds a UTC readout to it.
+	Zones []Zone
+	UTC   bool
+	Style string
+	// Fahrplan and Rooms are shown by the fahrplan face, the countdown
+	// runs to Target and plays the Finale with FinaleText for FinaleTime.
+	Fahrplan   *fahrplan.Fahrplan
+	Rooms      []string
+	Target     Target
+	Finale     string
+	FinaleText string
+	FinaleTime time.Duration
+}
+
+// Palette holds the colors of a face. Colors left at the zero value are
+// filled in with the defaults of the face.
+type Palette struct {
+	Foreground color.RGBA // hands, digits, lit bits and words
+	Accent     color.RGBA // second hand, seconds, hours of the Mengenlehreuhr
+	Dim        color.RGBA // segments, bits and letters that are off
+	Text       color.RGBA // date and time labels
+}
+
+func (p Palette) withDefaults(d Palette) Palette {
+	if p.Foreground == (color.RGBA{}) {
+		p.Foreground = d.Foreground
+	}
+	if p.Accent == (color.RGBA{}) {
+		p.Accent = d.Accent
+	}
+	if p.Dim == (color.RGBA{}) {
+		p.Dim = d.Dim
+	}
+	if p.Text == (color.RGBA{}) {
+		p.Text = d.Text
+	}
+	return p
+}
+
+var faces = map[string]func(FaceOptions) Face{
+	"analog":      newAnalogFace,
+	"digital":     newDigitalFace,
+	"binary":      newBinaryFace,
+	"wortuhr":     newWordFace,
+	"mengenlehre": newMengenlehreFace,
+	"world":       newWorldFace,
+	"countdown":   newCountdownFace,
+	"fahrplan":    newFahrplanFace,
+}
+
+func faceNames() string {
+	names := make([]string, 0, len(faces))
+	for name := range faces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func newFace(name string, o FaceOptions) (Face, error) {
+	f, ok := faces[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown clock face %q, use one of %s", name, faceNames())
+	}
+	if strings.EqualFold(name, "world") && o.Style == "dials" {
+		n := max(1, len(o.Zones))
+		if o.UTC {
+			n++
+		}
+		if n > 4 {
+			return nil, fmt.Errorf("world clock dials show up to 4 zones, not %d, use rows or auto", n)
+		}
+	}
+	return f(o), nil
+}
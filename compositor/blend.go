@@ -0,0 +1,91 @@
+package compositor
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// Mode is how a layer is combined with the layers below it.
+type Mode int
+
+const (
+	// Normal draws the layer over what is below, with its alpha.
+	Normal Mode = iota
+	// Add adds the colors, for glows and light effects.
+	Add
+	// Multiply darkens what is below with the layer, white leaves it
+	// unchanged.
+	Multiply
+	// Screen lightens what is below with the layer, black leaves it
+	// unchanged.
+	Screen
+	// Replace copies the layer, alpha and all, onto what is below.
+	Replace
+)
+
+var modeNames = []string{"normal", "add", "multiply", "screen", "replace"}
+
+func (m Mode) String() string {
+	if m < 0 || int(m) >= len(modeNames) {
+		return "Mode(" + strconv.Itoa(int(m)) + ")"
+	}
+	return modeNames[m]
+}
+
+// ParseMode parses one of normal, add, multiply, screen or replace.
+func ParseMode(s string) (Mode, error) {
+	for i, name := range modeNames {
+		if strings.EqualFold(s, name) {
+			return Mode(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown blend mode %q, use one of %s", s, strings.Join(modeNames, ", "))
+}
+
+// blend combines src, moved by offset, into dst with mode, its colors
+// scaled by opacity from 0 to 256. Both are alpha-premultiplied.
+func blend(dst, src *image.RGBA, offset image.Point, mode Mode, opacity uint32) {
+	r := src.Rect.Add(offset).Intersect(dst.Rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		di := dst.PixOffset(r.Min.X, y)
+		si := src.PixOffset(r.Min.X-offset.X, y-offset.Y)
+		for x := r.Min.X; x < r.Max.X; x, di, si = x+1, di+4, si+4 {
+			d := dst.Pix[di : di+4 : di+4]
+			s := src.Pix[si : si+4 : si+4]
+			var sc [4]uint32
+			for i := range sc {
+				sc[i] = uint32(s[i]) * opacity >> 8
+			}
+			if sc[3] == 0 && mode != Replace {
+				continue
+			}
+			sa := sc[3]
+			da := uint32(d[3])
+			for i := 0; i < 4; i++ {
+				dc := uint32(d[i])
+				var v uint32
+				switch mode {
+				case Add:
+					v = min(255, dc+sc[i])
+				case Multiply:
+					if i == 3 {
+						v = sa + dc - sa*dc/255
+					} else {
+						// the premultiplied form, so uncovered parts of either
+						// side keep the other
+						v = (sc[i]*dc + sc[i]*(255-da) + dc*(255-sa)) / 255
+					}
+				case Screen:
+					v = sc[i] + dc - sc[i]*dc/255
+				case Replace:
+					v = sc[i]
+				default:
+					v = sc[i] + dc*(255-sa)/255
+				}
+				d[i] = uint8(min(255, v))
+			}
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// Package compositor stacks translucent layers into the frame of the
+// panels, so a status bar, messages or effects can sit on top of
+// whatever app is running without it knowing.
+//
+// A Compositor is a panel.Overlay: the app draws into the frame of its
+// panel.Output as usual, which becomes the layer at Z 0. Layers with a
+// higher Z are drawn on top of it, the ones with a negative Z below.
+package compositor
+
+import (
+	"image"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Source draws the content of a layer. overlay.Overlay and StatusBar
+// are sources.
+type Source interface {
+	Draw(img *image.RGBA)
+}
+
+// SourceFunc adapts a function to a Source.
+type SourceFunc func(img *image.RGBA)
+
+// Draw calls f(img).
+func (f SourceFunc) Draw(img *image.RGBA) {
+	f(img)
+}
+
+// Layer is an image with alpha that is blended into the frame.
+type Layer struct {
+	Name string
+	// Z orders the layers, higher is on top, the app is at 0. Layers
+	// with the same Z are drawn in the order they were added.
+	Z int
+	// Image holds the pixels. With a Source it is cleared and redrawn
+	// before every frame, and allocated in the size of the frame if nil.
+	Image  *image.RGBA
+	Source Source
+	// Offset moves the layer on the frame, for sliding it in and out.
+	Offset image.Point
+	Mode   Mode
+	// Opacity from 0 (invisible) to 1 scales the alpha of the layer.
+	Opacity float64
+	Hidden  bool
+}
+
+// NewLayer returns a fully opaque Normal layer drawn by src.
+func NewLayer(name string, z int, src Source) *Layer {
+	return &Layer{Name: name, Z: z, Source: src, Opacity: 1}
+}
+
+// Compositor holds the layers. It is safe for use from several
+// goroutines, as long as layers are changed through Update once added.
+type Compositor struct {
+	mu     sync.Mutex
+	layers []*Layer
+	app    *image.RGBA
+}
+
+// New returns a compositor without layers.
+func New() *Compositor {
+	return &Compositor{}
+}
+
+// Add adds l, replacing a layer with the same name.
+func (c *Compositor) Add(l *Layer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(l.Name)
+	c.layers = append(c.layers, l)
+	sort.SliceStable(c.layers, func(i, j int) bool {
+		return c.layers[i].Z < c.layers[j].Z
+	})
+}
+
+// Remove removes the layer called name, if there is one.
+func (c *Compositor) Remove(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(name)
+}
+
+func (c *Compositor) remove(name string) {
+	for i, l := range c.layers {
+		if l.Name == name {
+			c.layers = append(c.layers[:i], c.layers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Update calls f with the layer called name while no frame is being
+// composed, and reports whether there is such a layer.
+func (c *Compositor) Update(name string, f func(l *Layer)) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, l := range c.layers {
+		if l.Name == name {
+			z := l.Z
+			f(l)
+			if l.Z != z {
+				sort.SliceStable(c.layers, func(i, j int) bool {
+					return c.layers[i].Z < c.layers[j].Z
+				})
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Names returns the names of the layers from bottom to top.
+func (c *Compositor) Names() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names := make([]string, len(c.layers))
+	for i, l := range c.layers {
+		names[i] = l.Name
+	}
+	return names
+}
+
+// Compose blends all layers over dst, bottom to top.
+func (c *Compositor) Compose(dst *image.RGBA) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, l := range c.layers {
+		c.draw(dst, l)
+	}
+}
+
+// Draw composes the layers around the app's frame.
+func (c *Compositor) Draw(frame *image.RGBA) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	below := 0
+	for below < len(c.layers) && c.layers[below].Z < 0 {
+		below++
+	}
+	if below > 0 {
+		// the app's pixels go on top of the lower layers
+		if c.app == nil || c.app.Rect != frame.Rect {
+			c.app = image.NewRGBA(frame.Rect)
+		}
+		copy(c.app.Pix, frame.Pix)
+		clear(frame.Pix)
+		for _, l := range c.layers[:below] {
+			c.draw(frame, l)
+		}
+		blend(frame, c.app, image.Point{}, Normal, 256)
+	}
+	for _, l := range c.layers[below:] {
+		c.draw(frame, l)
+	}
+}
+
+func (c *Compositor) draw(dst *image.RGBA, l *Layer) {
+	if l.Hidden {
+		return
+	}
+	if l.Source != nil {
+		if l.Image == nil {
+			l.Image = image.NewRGBA(dst.Rect)
+		}
+		clear(l.Image.Pix)
+		l.Source.Draw(l.Image)
+	}
+	if l.Image == nil || l.Opacity <= 0 {
+		return
+	}
+	opacity := uint32(math.Round(math.Min(l.Opacity, 1) * 256))
+	blend(dst, l.Image, l.Offset, l.Mode, opacity)
+}
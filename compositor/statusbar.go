@@ -0,0 +1,87 @@
+package compositor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"time"
+
+	"golang.org/x/image/font"
+
+	"github.com/SimonWaldherr/RGB-LED-Matrix/text"
+)
+
+// StatusBar is a Source that shows the time in a band at the top or
+// bottom edge, small enough to leave the app visible.
+type StatusBar struct {
+	Face font.Face
+	// Format is the time layout, like 15:04.
+	Format   string
+	Location *time.Location
+	Color    color.RGBA
+	Band     color.RGBA
+	Bottom   bool
+	Align    text.Align
+}
+
+// NewStatusBar returns a status bar showing hours and minutes in white
+// on a translucent black band.
+func NewStatusBar(face font.Face, bottom bool) *StatusBar {
+	return &StatusBar{
+		Face:     face,
+		Format:   "15:04",
+		Location: time.Local,
+		Color:    color.RGBA{255, 255, 255, 255},
+		Band:     color.RGBA{0, 0, 0, 160},
+		Bottom:   bottom,
+		Align:    text.Right,
+	}
+}
+
+// ParseStatusBar parses top or bottom, optionally with a time layout
+// after a colon like bottom:15:04:05. An empty s returns nil.
+func ParseStatusBar(s string, face font.Face) (*StatusBar, error) {
+	if s == "" {
+		return nil, nil
+	}
+	edge, format, _ := strings.Cut(s, ":")
+	var b *StatusBar
+	switch edge {
+	case "top":
+		b = NewStatusBar(face, false)
+	case "bottom":
+		b = NewStatusBar(face, true)
+	default:
+		return nil, fmt.Errorf("unknown status bar %q, use top or bottom", s)
+	}
+	if format != "" {
+		b.Format = format
+	}
+	return b, nil
+}
+
+// Draw draws the status bar onto img.
+func (b *StatusBar) Draw(img *image.RGBA) {
+	m := b.Face.Metrics()
+	height := (m.Ascent + m.Descent).Ceil() + 2
+	band := image.Rect(img.Rect.Min.X, img.Rect.Min.Y, img.Rect.Max.X, img.Rect.Min.Y+height)
+	if b.Bottom {
+		band = image.Rect(img.Rect.Min.X, img.Rect.Max.Y-height, img.Rect.Max.X, img.Rect.Max.Y)
+	}
+	draw.Draw(img, band, image.NewUniform(b.Band), image.Point{}, draw.Over)
+
+	x := band.Min.X + 2
+	switch b.Align {
+	case text.Center:
+		x = (band.Min.X + band.Max.X) / 2
+	case text.Right:
+		x = band.Max.X - 2
+	}
+	now := time.Now()
+	if b.Location != nil {
+		now = now.In(b.Location)
+	}
+	text.Draw(img, b.Face, x, band.Min.Y+1+m.Ascent.Ceil(), now.Format(b.Format), b.Color, b.Align)
+}
@@ -0,0 +1,268 @@
+// Package config reads the settings of the programs from a TOML or YAML
+// file, so the whole wall is configured in one place instead of long
+// command lines. Settings are named like the flags; flags given on the
+// command line override the file.
+//
+// A file looks like
+//
+//	brightness = 80
+//
+//	[led]
+//	pwm-bits = 6
+//	scan-mode = "interlaced"
+//
+//	[power]
+//	budget = 20
+//
+//	[calibration]
+//	gamma = 2.2
+//	white_balance = [1.0, 0.9, 0.75]
+//
+//	[clock]
+//	face = "wortuhr"
+//
+//	[image]
+//	playlist = ["intro.gif=30s", "/srv/bilder"]
+//
+//	[scenes.nacht]
+//	brightness = 20
+//	[scenes.nacht.clock]
+//	face = "digital"
+//
+// Top level keys set the flag of the same name. The section of the
+// program, like [clock], does too, other programs' sections are ignored.
+// In any other section a key is the flag named section-key, like
+// [power] budget for -power-budget, or just key if there is no such
+// flag. Lists are joined with commas, and the [calibration] section is
+// passed on as the calibration itself instead of a file name.
+//
+// Scenes are named sets of settings on top of the rest of the file,
+// switched at runtime with Reloader.SetScene.
+//
+// Shared settings a program doesn't have, like the face for the ticker,
+// are skipped, so one file can serve all programs.
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Apps are the names of the programs, their sections only apply to
+// them.
+var Apps = []string{"clock", "ticker", "gif", "image", "cgol", "flut"}
+
+// parsed remembers what Parse did, for reloading.
+var parsed = struct {
+	app      string
+	filename string
+	given    map[string]bool
+	settings Settings
+}{given: map[string]bool{}}
+
+// Settings is the content of a config file.
+type Settings map[string]any
+
+// Load reads filename, which is TOML or, ending in .yml or .yaml, YAML.
+func Load(filename string) (Settings, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	s := Settings{}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(data, &s)
+	default:
+		err = toml.Unmarshal(data, &s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return s, nil
+}
+
+// Apply sets the flags of fs for app from s. Flags that were set on the
+// command line are left alone. Unknown keys in the section of app are
+// an error, it's most likely a typo.
+func (s Settings) Apply(fs *flag.FlagSet, app string) error {
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	return s.apply(fs, app, given)
+}
+
+// apply sets the flags of fs that aren't given.
+func (s Settings) apply(fs *flag.FlagSet, app string, given map[string]bool) error {
+	set := func(name string, v any) error {
+		if given[name] {
+			return nil
+		}
+		value, err := format(v)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		return nil
+	}
+
+	for _, key := range keys(s) {
+		v := s[key]
+		if fs.Lookup(key) != nil {
+			if err := set(key, v); err != nil {
+				return err
+			}
+			continue
+		}
+		section, ok := table(v)
+		if !ok {
+			continue
+		}
+		switch {
+		case key == "scenes":
+			// applied by Reloader.SetScene
+		case key == app:
+			for _, k := range keys(section) {
+				if fs.Lookup(k) == nil {
+					return fmt.Errorf("[%s] %s: unknown setting", app, k)
+				}
+				if err := set(k, section[k]); err != nil {
+					return fmt.Errorf("[%s] %v", app, err)
+				}
+			}
+		case isApp(key):
+			// another program's section
+		default:
+			for _, k := range keys(section) {
+				name := key + "-" + k
+				if fs.Lookup(name) == nil {
+					name = k
+				}
+				if fs.Lookup(name) == nil {
+					continue
+				}
+				if err := set(name, section[k]); err != nil {
+					return fmt.Errorf("[%s] %v", key, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Parse parses the command line like flag.Parse, adding a -config flag
+// which defaults to $LEDMATRIX_CONFIG. The file is applied for app and
+// the effective settings are logged.
+func Parse(app string) error {
+	filename := flag.String("config", os.Getenv("LEDMATRIX_CONFIG"), "TOML or YAML file with the settings, flags override it")
+	flag.Parse()
+	parsed.app, parsed.filename = app, *filename
+	flag.Visit(func(f *flag.Flag) { parsed.given[f.Name] = true })
+	if *filename != "" {
+		s, err := Load(*filename)
+		if err != nil {
+			return err
+		}
+		if err := s.Apply(flag.CommandLine, app); err != nil {
+			return fmt.Errorf("%s: %v", *filename, err)
+		}
+		parsed.settings = s
+	}
+	var b strings.Builder
+	Write(&b, flag.CommandLine, app)
+	log.Printf("settings:\n%s", b.String())
+	return nil
+}
+
+// Write writes the current value of every flag in fs as a config file
+// section for app, which can be loaded again.
+func Write(w io.StringWriter, fs *flag.FlagSet, app string) {
+	w.WriteString("[" + app + "]\n")
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+		w.WriteString(f.Name + " = " + literal(f.Value) + "\n")
+	})
+}
+
+// literal returns v as a TOML value.
+func literal(v flag.Value) string {
+	if g, ok := v.(flag.Getter); ok {
+		switch g.Get().(type) {
+		case bool, int, int64, uint, uint64, float64:
+			return v.String()
+		}
+	}
+	return strconv.Quote(v.String())
+}
+
+// format turns a value of the file into the text of a flag.
+func format(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	case time.Time:
+		return v.Format(time.RFC3339), nil
+	case []any:
+		parts := make([]string, len(v))
+		for i, e := range v {
+			s, err := format(e)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = s
+		}
+		return strings.Join(parts, ","), nil
+	case map[string]any:
+		data, err := json.Marshal(v)
+		return string(data), err
+	}
+	return "", fmt.Errorf("unsupported value %v", v)
+}
+
+// table returns v as a section.
+func table(v any) (map[string]any, bool) {
+	switch v := v.(type) {
+	case map[string]any:
+		return v, true
+	case Settings:
+		return v, true
+	}
+	return nil, false
+}
+
+func isApp(name string) bool {
+	for _, app := range Apps {
+		if name == app {
+			return true
+		}
+	}
+	return false
+}
+
+// keys returns the keys of m in order, so settings are applied the same
+// way every time.
+func keys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	rgbmatrix "simonwaldherr.de/go/rpirgbled"
+)
+
+// Matrix holds the hardware settings every program needs to open the
+// panels, and how the picture is turned on the wall.
+type Matrix struct {
+	Rows              int
+	Chain             int
+	Parallel          int
+	Brightness        int
+	PWMBits           int
+	PWMLSBNanoseconds int
+	ScanMode          string
+	NoHardwarePulse   bool
+	Mapping           string
+	Rotate            int
+}
+
+// MatrixFlags adds the hardware flags to fs. The defaults are the
+// settings of the wall.
+func MatrixFlags(fs *flag.FlagSet) *Matrix {
+	m := &Matrix{}
+	fs.IntVar(&m.Rows, "led-rows", 32, "number of rows supported")
+	fs.IntVar(&m.Parallel, "led-parallel", 1, "number of daisy-chained panels")
+	fs.IntVar(&m.Chain, "led-chain", 16, "number of displays daisy-chained")
+	fs.IntVar(&m.Brightness, "brightness", 99, "brightness (0-100)")
+	fs.IntVar(&m.PWMBits, "led-pwm-bits", 6, "PWM bits per color, fewer give a higher refresh rate (1-11)")
+	fs.IntVar(&m.PWMLSBNanoseconds, "led-pwm-lsb-nanoseconds", 95, "duration of the lowest PWM bit in nanoseconds")
+	fs.StringVar(&m.ScanMode, "led-scan-mode", "interlaced", "scan mode: progressive or interlaced")
+	fs.BoolVar(&m.NoHardwarePulse, "led-no-hardware-pulse", false, "don't use the hardware pin-pulse generator")
+	fs.StringVar(&m.Mapping, "led-gpio-mapping", "regular", "GPIO mapping: regular, adafruit-hat or adafruit-hat-pwm")
+	fs.IntVar(&m.Rotate, "rotate", 0, "rotate the picture clockwise by 0, 90, 180 or 270 degrees")
+	return m
+}
+
+// HardwareConfig returns the configuration for rgbmatrix.NewRGBLedMatrix.
+func (m *Matrix) HardwareConfig() (*rgbmatrix.HardwareConfig, error) {
+	config := rgbmatrix.DefaultConfig
+	config.Rows = m.Rows
+	config.ChainLength = m.Chain
+	config.Parallel = m.Parallel
+	config.Brightness = m.Brightness
+	config.PWMBits = m.PWMBits
+	config.PWMLSBNanoseconds = m.PWMLSBNanoseconds
+	config.DisableHardwarePulsing = m.NoHardwarePulse
+	config.HardwareMapping = m.Mapping
+
+	switch strings.ToLower(m.ScanMode) {
+	case "progressive":
+		config.ScanMode = rgbmatrix.Progressive
+	case "interlaced":
+		config.ScanMode = rgbmatrix.Interlaced
+	default:
+		return nil, fmt.Errorf("unknown scan mode %q, want progressive or interlaced", m.ScanMode)
+	}
+	if m.Brightness < 0 || m.Brightness > 100 {
+		return nil, fmt.Errorf("brightness %d out of range 0-100", m.Brightness)
+	}
+	if m.PWMBits < 1 || m.PWMBits > 11 {
+		return nil, fmt.Errorf("%d PWM bits out of range 1-11", m.PWMBits)
+	}
+	switch m.Rotate {
+	case 0, 90, 180, 270:
+	default:
+		return nil, fmt.Errorf("can't rotate by %d degrees, want 0, 90, 180 or 270", m.Rotate)
+	}
+	return &config, nil
+}
+
+// Reopen reports whether the panels opened with opened have to be
+// opened again for the current settings. Lowering the brightness
+// doesn't count, Limit does that in software.
+func (m *Matrix) Reopen(opened *rgbmatrix.HardwareConfig) (bool, error) {
+	config, err := m.HardwareConfig()
+	if err != nil {
+		return false, err
+	}
+	if config.Brightness <= opened.Brightness {
+		config.Brightness = opened.Brightness
+	}
+	return *config != *opened, nil
+}
+
+// Limit returns the brightness in percent of the brightness the panels
+// were opened with, for dimming.Controller.SetLimit.
+func (m *Matrix) Limit(opened *rgbmatrix.HardwareConfig) int {
+	if opened.Brightness <= 0 {
+		return 100
+	}
+	return min(100, m.Brightness*100/opened.Brightness)
+}
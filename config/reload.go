@@ -0,0 +1,237 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Settle is how long the config file has to stay unchanged before it is
+// reloaded.
+var Settle = 500 * time.Millisecond
+
+// Changes are what a reload changed.
+type Changes struct {
+	// Settings holds the names of the flags with a new value.
+	Settings map[string]bool
+	// Signal is set for a reload by SIGHUP, which also asks to read
+	// fonts, images and other files again that may have changed under
+	// the same name.
+	Signal bool
+	// Scenes is set when scenes were added to the file or removed.
+	Scenes bool
+}
+
+// Has reports whether any of the settings names changed.
+func (c *Changes) Has(names ...string) bool {
+	for _, name := range names {
+		if c.Settings[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// Files reports whether files named by the settings names should be
+// read again, because a setting changed or on SIGHUP.
+func (c *Changes) Files(names ...string) bool {
+	return c.Signal || c.Has(names...)
+}
+
+// Reloader reloads the config file given to Parse on SIGHUP and when
+// the file is written. The new settings are only applied by Reload, so
+// the render loop decides when they change under it.
+type Reloader struct {
+	mu      sync.Mutex
+	pending bool
+	signal  bool
+	scene   string
+}
+
+// Watch starts reloading in the background. Without a config file
+// SIGHUP still reloads the files named by the flags.
+func Watch() *Reloader {
+	r := &Reloader{}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			log.Printf("SIGHUP, reloading")
+			r.mark(true)
+		}
+	}()
+
+	if parsed.filename == "" {
+		return r
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("config: not watching %s: %v", parsed.filename, err)
+		return r
+	}
+	// editors replace the file, so the directory is watched
+	name := filepath.Clean(parsed.filename)
+	if err := watcher.Add(filepath.Dir(name)); err != nil {
+		log.Printf("config: not watching %s: %v", parsed.filename, err)
+		watcher.Close()
+		return r
+	}
+	go func() {
+		// an editor saving the file causes a burst of events and may
+		// leave it empty for a moment, so wait until it settled
+		settled := time.AfterFunc(time.Hour, func() { r.mark(false) })
+		settled.Stop()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) == name && (event.Has(fsnotify.Write) || event.Has(fsnotify.Create) || event.Has(fsnotify.Rename)) {
+					settled.Reset(Settle)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("config: %v", err)
+			}
+		}
+	}()
+	return r
+}
+
+// Scenes returns the names of the scenes in the config file.
+func (r *Reloader) Scenes() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	scenes, _ := table(parsed.settings["scenes"])
+	return keys(scenes)
+}
+
+// Scene returns the current scene, empty for none.
+func (r *Reloader) Scene() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.scene
+}
+
+// SetScene switches to the scene name, empty for just the file. Like a
+// changed file, the next Reload applies it.
+func (r *Reloader) SetScene(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if name != "" {
+		scenes, _ := table(parsed.settings["scenes"])
+		if _, ok := table(scenes[name]); !ok {
+			return fmt.Errorf("unknown scene %q", name)
+		}
+	}
+	r.scene = name
+	r.pending = true
+	return nil
+}
+
+func (r *Reloader) mark(signal bool) {
+	r.mu.Lock()
+	r.pending = true
+	r.signal = r.signal || signal
+	r.mu.Unlock()
+}
+
+// Reload applies the config file again if it changed or SIGHUP arrived
+// since the last call and returns what changed, nil if there is nothing
+// to do. Settings removed from the file go back to their defaults,
+// flags from the command line still win. A broken file is logged and
+// the settings are kept.
+func (r *Reloader) Reload() *Changes {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	pending, signal, scene := r.pending, r.signal, r.scene
+	r.pending, r.signal = false, false
+	r.mu.Unlock()
+	if !pending {
+		return nil
+	}
+
+	scenes := strings.Join(r.Scenes(), ",")
+	fs := flag.CommandLine
+	old := map[string]string{}
+	fs.VisitAll(func(f *flag.Flag) { old[f.Name] = f.Value.String() })
+
+	if err := r.reload(fs, scene); err != nil {
+		log.Printf("config: %v, keeping the settings", err)
+		for name, value := range old {
+			fs.Set(name, value)
+		}
+		if !signal {
+			return nil
+		}
+	}
+
+	changes := &Changes{Settings: map[string]bool{}, Signal: signal}
+	changes.Scenes = strings.Join(r.Scenes(), ",") != scenes
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Value.String() != old[f.Name] {
+			changes.Settings[f.Name] = true
+			names = append(names, f.Name+" = "+literal(f.Value))
+		}
+	})
+	sort.Strings(names)
+	if len(names) > 0 {
+		log.Printf("config: changed %s", strings.Join(names, ", "))
+	} else if !signal && !changes.Scenes {
+		return nil
+	}
+	return changes
+}
+
+// reload resets the flags that weren't given on the command line and
+// applies the file and scene.
+func (r *Reloader) reload(fs *flag.FlagSet, scene string) error {
+	if parsed.filename == "" {
+		return nil
+	}
+	s, err := Load(parsed.filename)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	parsed.settings = s
+	r.mu.Unlock()
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if !parsed.given[f.Name] {
+			f.Value.Set(f.DefValue)
+		}
+	})
+	if err := s.apply(fs, parsed.app, parsed.given); err != nil {
+		return err
+	}
+	if scene == "" {
+		return nil
+	}
+	scenes, _ := table(s["scenes"])
+	settings, ok := table(scenes[scene])
+	if !ok {
+		return fmt.Errorf("scene %q is gone", scene)
+	}
+	if err := Settings(settings).apply(fs, parsed.app, parsed.given); err != nil {
+		return fmt.Errorf("scene %s: %v", scene, err)
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+// Package dimming dims the wall at runtime, following a time of day
+// schedule or a light sensor, and ramps smoothly between levels.
+//
+// Levels are percentages of the hardware brightness the matrix was
+// started with, so -brightness stays the upper limit. A lower limit set
+// at runtime scales all levels down.
+package dimming
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Point is a brightness level at a time of day.
+type Point struct {
+	At    time.Duration // since midnight
+	Level int
+}
+
+// Schedule is a list of points sorted by time. Levels in between are
+// interpolated linearly, wrapping around midnight.
+type Schedule []Point
+
+// ParseSchedule parses a schedule like "07:00=100,20:00=60,23:30=15".
+func ParseSchedule(s string) (Schedule, error) {
+	var sched Schedule
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		at, level, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("schedule entry %q: want hh:mm=percent", part)
+		}
+		t, err := time.Parse("15:04", strings.TrimSpace(at))
+		if err != nil {
+			return nil, fmt.Errorf("schedule entry %q: %v", part, err)
+		}
+		l, err := strconv.Atoi(strings.TrimSpace(level))
+		if err != nil || l < 0 || l > 100 {
+			return nil, fmt.Errorf("schedule entry %q: level must be 0-100", part)
+		}
+		sched = append(sched, Point{At: time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, Level: l})
+	}
+	sort.Slice(sched, func(i, j int) bool { return sched[i].At < sched[j].At })
+	return sched, nil
+}
+
+// Level returns the scheduled level at t.
+func (s Schedule) Level(t time.Time) float64 {
+	if len(s) == 0 {
+		return 100
+	}
+	if len(s) == 1 {
+		return float64(s[0].Level)
+	}
+	const day = 24 * time.Hour
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+
+	// find the points before and after now, wrapping around midnight
+	next := sort.Search(len(s), func(i int) bool { return s[i].At > now })
+	prev := next - 1
+	if prev < 0 {
+		prev = len(s) - 1
+	}
+	if next == len(s) {
+		next = 0
+	}
+
+	span := (s[next].At - s[prev].At + day) % day
+	if span == 0 {
+		return float64(s[prev].Level)
+	}
+	pos := (now - s[prev].At + day) % day
+	f := float64(pos) / float64(span)
+	return float64(s[prev].Level) + f*float64(s[next].Level-s[prev].Level)
+}
+
+// Sensor reads a light level from a file, like the illuminance of an
+// IIO device in sysfs or a file written by another program.
+type Sensor struct {
+	Path string
+	Min  float64 // reading mapped to MinLevel
+	Max  float64 // reading mapped to 100 percent
+
+	MinLevel int
+}
+
+// ParseSensorRange parses a "min:max" range of sensor readings.
+func ParseSensorRange(s string) (min, max float64, err error) {
+	lo, hi, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("sensor range %q: want min:max", s)
+	}
+	if min, err = strconv.ParseFloat(strings.TrimSpace(lo), 64); err != nil {
+		return 0, 0, fmt.Errorf("sensor range %q: %v", s, err)
+	}
+	if max, err = strconv.ParseFloat(strings.TrimSpace(hi), 64); err != nil {
+		return 0, 0, fmt.Errorf("sensor range %q: %v", s, err)
+	}
+	if max <= min {
+		return 0, 0, fmt.Errorf("sensor range %q: max must be above min", s)
+	}
+	return min, max, nil
+}
+
+// Level reads the sensor and maps the reading to a level.
+func (s *Sensor) Level() (float64, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", s.Path, err)
+	}
+	f := math.Max(0, math.Min(1, (v-s.Min)/(s.Max-s.Min)))
+	return float64(s.MinLevel) + f*float64(100-s.MinLevel), nil
+}
+
+// Controller follows the schedule or sensor and ramps the current level
+// towards it. Without either it stays at 100 percent. Once started, the
+// settings only change through Configure.
+type Controller struct {
+	Schedule Schedule
+	Sensor   *Sensor
+	// Ramp is the time a change from 0 to 100 percent takes.
+	Ramp time.Duration
+
+	mu            sync.Mutex
+	limit         int
+	level         float64
+	override      int
+	overrideUntil time.Time
+	overridden    bool
+	sensorLevel   float64
+	sensorRead    time.Time
+	sensorFailed  bool
+	stop          chan struct{}
+}
+
+// New returns a controller for the textual flag values. Empty schedule
+// and sensor values disable them.
+func New(schedule, sensor, sensorRange string, ramp time.Duration) (*Controller, error) {
+	c := &Controller{Ramp: ramp, limit: 100}
+	var err error
+	if c.Schedule, err = ParseSchedule(schedule); err != nil {
+		return nil, err
+	}
+	if sensor != "" {
+		min, max, err := ParseSensorRange(sensorRange)
+		if err != nil {
+			return nil, err
+		}
+		c.Sensor = &Sensor{Path: sensor, Min: min, Max: max, MinLevel: 5}
+	}
+	c.level = c.target(time.Now())
+	return c, nil
+}
+
+// Configure switches to the textual flag values like New, keeping the
+// current level, the limit and an override. On errors the settings stay.
+func (c *Controller) Configure(schedule, sensor, sensorRange string, ramp time.Duration) error {
+	n, err := New(schedule, sensor, sensorRange, ramp)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Schedule, c.Sensor, c.Ramp = n.Schedule, n.Sensor, n.Ramp
+	c.sensorRead, c.sensorFailed = time.Time{}, false
+	return nil
+}
+
+// Level returns the current level in percent.
+func (c *Controller) Level() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return int(math.Round(c.level * float64(c.limit) / 100))
+}
+
+// SetLimit scales all levels to limit percent, for lowering the
+// brightness without opening the panels again.
+func (c *Controller) SetLimit(limit int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limit = max(0, min(100, limit))
+}
+
+// Limit returns the limit set by SetLimit, 100 by default.
+func (c *Controller) Limit() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.limit
+}
+
+// Override fixes the level for d, or until ClearOverride if d is 0.
+// The level still ramps to the override.
+func (c *Controller) Override(level int, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.override = max(0, min(100, level))
+	c.overridden = true
+	c.overrideUntil = time.Time{}
+	if d > 0 {
+		c.overrideUntil = time.Now().Add(d)
+	}
+}
+
+// ClearOverride returns to the schedule or sensor.
+func (c *Controller) ClearOverride() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.overridden = false
+}
+
+// Start updates the level in the background until Stop is called.
+func (c *Controller) Start() {
+	c.mu.Lock()
+	if c.stop != nil {
+		c.mu.Unlock()
+		return
+	}
+	c.stop = make(chan struct{})
+	stop := c.stop
+	c.mu.Unlock()
+
+	const interval = 50 * time.Millisecond
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				c.step(now, interval)
+			}
+		}
+	}()
+}
+
+// Stop ends the background updates.
+func (c *Controller) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
+
+func (c *Controller) step(now time.Time, dt time.Duration) {
+	target := c.target(now)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Ramp <= 0 {
+		c.level = target
+		return
+	}
+	maxStep := 100 * float64(dt) / float64(c.Ramp)
+	c.level += math.Max(-maxStep, math.Min(maxStep, target-c.level))
+}
+
+func (c *Controller) target(now time.Time) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.overridden && (c.overrideUntil.IsZero() || now.Before(c.overrideUntil)) {
+		return float64(c.override)
+	}
+	c.overridden = false
+
+	if c.Sensor != nil {
+		// sensors are slow and noisy, once a second is plenty
+		if now.Sub(c.sensorRead) >= time.Second {
+			level, err := c.Sensor.Level()
+			if err != nil && !c.sensorFailed {
+				log.Printf("dimming: sensor %v, using the schedule", err)
+			}
+			c.sensorLevel, c.sensorFailed, c.sensorRead = level, err != nil, now
+		}
+		if !c.sensorFailed {
+			return c.sensorLevel
+		}
+	}
+	return c.Schedule.Level(now)
+}
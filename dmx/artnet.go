@@ -0,0 +1,32 @@
+package dmx
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const artnetPort = 6454
+
+// artnetID starts every Art-Net packet.
+var artnetID = []byte("Art-Net\x00")
+
+// opDmx is the opcode of ArtDmx, the packet with the channels.
+const opDmx = 0x5000
+
+// artnet handles an ArtDmx packet, other opcodes are ignored.
+func (r *Receiver) artnet(p []byte) {
+	const data = 18
+	if len(p) < data || !bytes.Equal(p[:8], artnetID) {
+		return
+	}
+	if binary.LittleEndian.Uint16(p[8:10]) != opDmx {
+		return
+	}
+	// the port-address is Net, Sub-Net and Universe
+	universe := int(p[15]&0x7f)<<8 | int(p[14])
+	length := int(binary.BigEndian.Uint16(p[16:18]))
+	if data+length > len(p) {
+		return
+	}
+	r.universe(universe, p[data:data+length])
+}
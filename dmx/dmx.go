@@ -0,0 +1,316 @@
+// Package dmx turns the wall into a pixel fixture for lighting consoles.
+// It receives DMX universes over E1.31 (sACN) and Art-Net and maps them
+// onto the logical 128x128 picture: every pixel takes three channels,
+// and each universe continues where the previous one stopped.
+//
+// With the defaults a universe carries 170 pixels on channels 1-510, so
+// the wall needs 97 universes, starting at universe 1.
+package dmx
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+// Size is the width and height of the picture.
+const Size = 128
+
+// Config holds the receiver settings.
+type Config struct {
+	// Protocols are the protocols to listen for, e131, artnet or both
+	// separated by a comma. Empty disables the receiver.
+	Protocols string
+	// Address is the IP address to listen on, empty for all.
+	Address string
+	// Multicast joins the E1.31 multicast groups of the universes,
+	// otherwise the console has to send unicast.
+	Multicast bool
+	// Universe is the universe of the top left pixel. Art-Net counts
+	// the port-address from 0, E1.31 universes start at 1.
+	Universe int
+	// Start is the first channel of a universe that is used, from 1.
+	Start int
+	// Channels is the number of channels used per universe, a multiple
+	// of 3.
+	Channels int
+	// Order is how the pixels run: rows, snake (every second row back)
+	// or columns.
+	Order string
+	// Colors is the order of the three channels of a pixel, like rgb or
+	// grb.
+	Colors string
+	// Timeout is how long the picture is kept without packets.
+	Timeout time.Duration
+}
+
+// Flags adds the receiver flags to fs.
+func Flags(fs *flag.FlagSet) *Config {
+	c := &Config{}
+	fs.StringVar(&c.Protocols, "dmx-protocols", "", "receive DMX from lighting consoles: e131, artnet or e131,artnet")
+	fs.StringVar(&c.Address, "dmx-address", "", "IP address to receive DMX on, empty for all")
+	fs.BoolVar(&c.Multicast, "dmx-multicast", false, "join the E1.31 multicast groups of the universes")
+	fs.IntVar(&c.Universe, "dmx-universe", 1, "universe of the top left pixel")
+	fs.IntVar(&c.Start, "dmx-start", 1, "first channel used in each universe")
+	fs.IntVar(&c.Channels, "dmx-channels", 510, "channels used per universe, three per pixel")
+	fs.StringVar(&c.Order, "dmx-order", "rows", "pixel order: rows, snake or columns")
+	fs.StringVar(&c.Colors, "dmx-colors", "rgb", "channel order of a pixel, like rgb, grb or bgr")
+	fs.DurationVar(&c.Timeout, "dmx-timeout", 5*time.Second, "time without packets before the local pictures come back")
+	return c
+}
+
+// Receiver collects the universes into a picture.
+type Receiver struct {
+	Config
+
+	colors [3]int
+	conns  []*net.UDPConn
+
+	mu    sync.Mutex
+	frame *image.RGBA
+	last  time.Time
+}
+
+// Listen checks the config and starts receiving.
+func Listen(config Config) (*Receiver, error) {
+	r := &Receiver{
+		Config: config,
+		frame:  image.NewRGBA(image.Rect(0, 0, Size, Size)),
+	}
+	if err := r.check(); err != nil {
+		return nil, err
+	}
+	for _, p := range strings.Split(config.Protocols, ",") {
+		var err error
+		switch strings.TrimSpace(strings.ToLower(p)) {
+		case "e131", "sacn":
+			var conn *net.UDPConn
+			// multicast only arrives at a socket bound to all addresses
+			conn, err = r.listen(e131Port, r.e131, !config.Multicast)
+			if err == nil && config.Multicast {
+				err = r.join(conn)
+			}
+		case "artnet":
+			_, err = r.listen(artnetPort, r.artnet, true)
+		default:
+			err = fmt.Errorf("unknown protocol %q, want e131 or artnet", p)
+		}
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("dmx: %v", err)
+		}
+	}
+	return r, nil
+}
+
+// check validates the layout.
+func (r *Receiver) check() error {
+	if r.Channels < 3 || r.Channels%3 != 0 {
+		return fmt.Errorf("dmx: %d channels per universe, want a multiple of 3", r.Channels)
+	}
+	if r.Start < 1 || r.Start+r.Channels-1 > 512 {
+		return fmt.Errorf("dmx: channels %d-%d don't fit into a universe", r.Start, r.Start+r.Channels-1)
+	}
+	if r.Universe < 0 || r.Universe+r.Universes()-1 > 32767 {
+		return fmt.Errorf("dmx: universe %d out of range", r.Universe)
+	}
+	switch r.Order {
+	case "rows", "snake", "columns":
+	default:
+		return fmt.Errorf("dmx: unknown pixel order %q, want rows, snake or columns", r.Order)
+	}
+	colors := strings.ToLower(r.Colors)
+	if len(colors) != 3 {
+		return fmt.Errorf("dmx: channel order %q, want three of r, g and b", r.Colors)
+	}
+	seen := map[int]bool{}
+	for i, ch := range colors {
+		c := strings.IndexRune("rgb", ch)
+		if c < 0 || seen[c] {
+			return fmt.Errorf("dmx: channel order %q, want three of r, g and b", r.Colors)
+		}
+		seen[c] = true
+		r.colors[i] = c
+	}
+	return nil
+}
+
+// Universes returns how many universes the picture takes.
+func (r *Receiver) Universes() int {
+	perUniverse := r.Channels / 3
+	return (Size*Size + perUniverse - 1) / perUniverse
+}
+
+// listen receives packets on port and hands them to handle, on Address
+// if bind is set.
+func (r *Receiver) listen(port int, handle func([]byte), bind bool) (*net.UDPConn, error) {
+	addr := &net.UDPAddr{Port: port}
+	if r.Address != "" && bind {
+		if addr.IP = net.ParseIP(r.Address); addr.IP == nil {
+			return nil, fmt.Errorf("invalid address %q", r.Address)
+		}
+	}
+	conn, err := net.ListenUDP("udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+	r.receive(conn, handle)
+	log.Printf("dmx: listening on %v for universes %d-%d", conn.LocalAddr(), r.Universe, r.Universe+r.Universes()-1)
+	return conn, nil
+}
+
+// join joins the multicast group of every universe, 239.255.hi.lo, on
+// the interface with Address or the default one.
+func (r *Receiver) join(conn *net.UDPConn) error {
+	var ifi *net.Interface
+	if r.Address != "" {
+		if ifi = byAddress(net.ParseIP(r.Address)); ifi == nil {
+			return fmt.Errorf("no interface with the address %s", r.Address)
+		}
+	}
+	p := ipv4.NewPacketConn(conn)
+	for u := r.Universe; u < r.Universe+r.Universes(); u++ {
+		group := &net.UDPAddr{IP: net.IPv4(239, 255, byte(u>>8), byte(u))}
+		if err := p.JoinGroup(ifi, group); errors.Is(err, syscall.ENOBUFS) {
+			// Linux allows 20 groups per socket by default
+			return fmt.Errorf("joining %v: %v, raise the sysctl net.ipv4.igmp_max_memberships to %d", group.IP, err, r.Universes())
+		} else if err != nil {
+			return fmt.Errorf("joining %v: %v", group.IP, err)
+		}
+	}
+	return nil
+}
+
+// byAddress returns the interface with the address ip, nil if there is
+// none.
+func byAddress(ip net.IP) *net.Interface {
+	ifaces, _ := net.Interfaces()
+	for i := range ifaces {
+		addrs, _ := ifaces[i].Addrs()
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && n.IP.Equal(ip) {
+				return &ifaces[i]
+			}
+		}
+	}
+	return nil
+}
+
+// receive reads packets from conn until it is closed.
+func (r *Receiver) receive(conn *net.UDPConn, handle func([]byte)) {
+	r.conns = append(r.conns, conn)
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, _, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			handle(buf[:n])
+		}
+	}()
+}
+
+// universe copies the DMX data of universe u, starting at channel 1,
+// into the picture.
+func (r *Receiver) universe(u int, data []byte) {
+	index := u - r.Universe
+	if index < 0 || index >= r.Universes() {
+		return
+	}
+	perUniverse := r.Channels / 3
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.last = time.Now()
+	for i := 0; i < perUniverse; i++ {
+		ch := r.Start - 1 + 3*i
+		if ch+3 > len(data) {
+			break
+		}
+		x, y, ok := r.pixel(index*perUniverse + i)
+		if !ok {
+			break
+		}
+		var rgb [3]uint8
+		for j, c := range r.colors {
+			rgb[c] = data[ch+j]
+		}
+		o := r.frame.PixOffset(x, y)
+		r.frame.Pix[o], r.frame.Pix[o+1], r.frame.Pix[o+2], r.frame.Pix[o+3] = rgb[0], rgb[1], rgb[2], 0xff
+	}
+}
+
+// pixel returns where the pixel number p is in the picture.
+func (r *Receiver) pixel(p int) (x, y int, ok bool) {
+	if p >= Size*Size {
+		return 0, 0, false
+	}
+	switch r.Order {
+	case "columns":
+		return p / Size, p % Size, true
+	case "snake":
+		if y := p / Size; y%2 == 1 {
+			return Size - 1 - p%Size, y, true
+		}
+	}
+	return p % Size, p / Size, true
+}
+
+// stop drops the picture, when a source says it stopped sending.
+func (r *Receiver) stop() {
+	r.mu.Lock()
+	r.clear()
+	r.mu.Unlock()
+}
+
+// clear makes the picture black, so the next source doesn't start with
+// the pixels of the last one. r.mu has to be held.
+func (r *Receiver) clear() {
+	r.last = time.Time{}
+	clear(r.frame.Pix)
+}
+
+// Active reports whether packets arrived within the timeout. A nil
+// receiver is never active.
+func (r *Receiver) Active() bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.last.IsZero() {
+		return false
+	}
+	if time.Since(r.last) >= r.Timeout {
+		r.clear()
+		return false
+	}
+	return true
+}
+
+// Frame copies the picture to dst, which must be Size by Size.
+func (r *Receiver) Frame(dst *image.RGBA) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copy(dst.Pix, r.frame.Pix)
+}
+
+// Close stops receiving.
+func (r *Receiver) Close() {
+	if r == nil {
+		return
+	}
+	for _, conn := range r.conns {
+		conn.Close()
+	}
+	r.conns = nil
+}
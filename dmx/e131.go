@@ -0,0 +1,40 @@
+package dmx
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const e131Port = 5568
+
+// e131ID is the packet identifier of the root layer.
+var e131ID = []byte("ASC-E1.17\x00\x00\x00")
+
+// e131 handles an E1.31 data packet. Preview data and packets with
+// another start code than 0 are ignored.
+func (r *Receiver) e131(p []byte) {
+	const data = 126
+	if len(p) < data || !bytes.Equal(p[4:16], e131ID) {
+		return
+	}
+	// root vector data, framing vector data, DMP vector set property
+	if binary.BigEndian.Uint32(p[18:22]) != 4 || binary.BigEndian.Uint32(p[40:44]) != 2 || p[117] != 2 {
+		return
+	}
+	options := p[112]
+	if options&0x80 != 0 {
+		return
+	}
+	if options&0x40 != 0 {
+		// the source stopped the stream
+		r.stop()
+		return
+	}
+	universe := int(binary.BigEndian.Uint16(p[113:115]))
+	// the property value count includes the start code
+	count := int(binary.BigEndian.Uint16(p[123:125]))
+	if count < 1 || p[125] != 0 || data+count-1 > len(p) {
+		return
+	}
+	r.universe(universe, p[data:data+count-1])
+}
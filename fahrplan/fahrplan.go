@@ -0,0 +1,234 @@
+// Package fahrplan reads congress schedules in the JSON and XML formats
+// exported by Frab and Pretalx.
+package fahrplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Talk is one event of the schedule.
+type Talk struct {
+	Title    string
+	Room     string
+	Speakers []string
+	Start    time.Time
+	Duration time.Duration
+}
+
+// End returns the time the talk is over.
+func (t Talk) End() time.Time {
+	return t.Start.Add(t.Duration)
+}
+
+// Fahrplan is a conference schedule with its talks sorted by start.
+type Fahrplan struct {
+	Title string
+	Talks []Talk
+
+	rooms []string
+}
+
+// Load reads a Frab or Pretalx schedule.json or schedule.xml. The format
+// is detected from the content.
+func Load(filename string) (*Fahrplan, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var f *Fahrplan
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '<' {
+		f, err = parseXML(data)
+	} else {
+		f, err = parseJSON(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	sort.SliceStable(f.Talks, func(i, j int) bool { return f.Talks[i].Start.Before(f.Talks[j].Start) })
+	return f, nil
+}
+
+// Rooms returns the rooms in the order they appear in the schedule.
+func (f *Fahrplan) Rooms() []string {
+	return f.rooms
+}
+
+// Current returns the talk running in room at now.
+func (f *Fahrplan) Current(room string, now time.Time) (Talk, bool) {
+	for _, t := range f.Talks {
+		if t.Room == room && !t.Start.After(now) && now.Before(t.End()) {
+			return t, true
+		}
+	}
+	return Talk{}, false
+}
+
+// Next returns the next talk starting in room after now. An empty room
+// matches all rooms.
+func (f *Fahrplan) Next(room string, now time.Time) (Talk, bool) {
+	for _, t := range f.Talks {
+		if (room == "" || t.Room == room) && t.Start.After(now) {
+			return t, true
+		}
+	}
+	return Talk{}, false
+}
+
+func (f *Fahrplan) add(day, room string, t Talk, date, start, duration string) error {
+	var err error
+	if t.Start, err = parseStart(day, date, start); err != nil {
+		return fmt.Errorf("talk %q: %v", t.Title, err)
+	}
+	if t.Duration, err = parseDuration(duration); err != nil {
+		return fmt.Errorf("talk %q: %v", t.Title, err)
+	}
+	if t.Room == "" {
+		t.Room = room
+	}
+	found := false
+	for _, r := range f.rooms {
+		found = found || r == t.Room
+	}
+	if !found {
+		f.rooms = append(f.rooms, t.Room)
+	}
+	f.Talks = append(f.Talks, t)
+	return nil
+}
+
+// parseStart prefers the full timestamp of the event and falls back to
+// the day and local start time.
+func parseStart(day, date, start string) (time.Time, error) {
+	if date != "" {
+		return time.Parse(time.RFC3339, date)
+	}
+	return time.ParseInLocation("2006-01-02 15:04", day+" "+start, time.Local)
+}
+
+// parseDuration parses durations like "00:45", "1:30" or "01:30:00".
+func parseDuration(s string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("duration %q: want hh:mm", s)
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second}[:len(parts)] {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("duration %q: want hh:mm", s)
+		}
+		d += time.Duration(n) * unit
+	}
+	return d, nil
+}
+
+type jsonSchedule struct {
+	Schedule struct {
+		Conference struct {
+			Title string `json:"title"`
+			Days  []struct {
+				Date  string                 `json:"date"`
+				Rooms map[string][]jsonEvent `json:"rooms"`
+			} `json:"days"`
+			Rooms []struct {
+				Name string `json:"name"`
+			} `json:"rooms"`
+		} `json:"conference"`
+	} `json:"schedule"`
+}
+
+type jsonEvent struct {
+	Title    string `json:"title"`
+	Room     string `json:"room"`
+	Date     string `json:"date"`
+	Start    string `json:"start"`
+	Duration string `json:"duration"`
+	Persons  []struct {
+		PublicName string `json:"public_name"`
+		Name       string `json:"name"`
+	} `json:"persons"`
+}
+
+func parseJSON(data []byte) (*Fahrplan, error) {
+	var s jsonSchedule
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	conf := s.Schedule.Conference
+	f := &Fahrplan{Title: conf.Title}
+
+	// rooms are a map in JSON, keep the order of the conference rooms
+	for _, r := range conf.Rooms {
+		f.rooms = append(f.rooms, r.Name)
+	}
+	for _, day := range conf.Days {
+		names := make([]string, 0, len(day.Rooms))
+		for name := range day.Rooms {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, room := range names {
+			for _, e := range day.Rooms[room] {
+				t := Talk{Title: e.Title, Room: e.Room}
+				for _, p := range e.Persons {
+					if p.PublicName != "" {
+						t.Speakers = append(t.Speakers, p.PublicName)
+					} else if p.Name != "" {
+						t.Speakers = append(t.Speakers, p.Name)
+					}
+				}
+				if err := f.add(day.Date, room, t, e.Date, e.Start, e.Duration); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return f, nil
+}
+
+type xmlSchedule struct {
+	Conference struct {
+		Title string `xml:"title"`
+	} `xml:"conference"`
+	Days []struct {
+		Date  string `xml:"date,attr"`
+		Rooms []struct {
+			Name   string `xml:"name,attr"`
+			Events []struct {
+				Title    string   `xml:"title"`
+				Room     string   `xml:"room"`
+				Date     string   `xml:"date"`
+				Start    string   `xml:"start"`
+				Duration string   `xml:"duration"`
+				Persons  []string `xml:"persons>person"`
+			} `xml:"event"`
+		} `xml:"room"`
+	} `xml:"day"`
+}
+
+func parseXML(data []byte) (*Fahrplan, error) {
+	var s xmlSchedule
+	if err := xml.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	f := &Fahrplan{Title: s.Conference.Title}
+	for _, day := range s.Days {
+		for _, room := range day.Rooms {
+			for _, e := range room.Events {
+				t := Talk{Title: strings.TrimSpace(e.Title), Room: e.Room, Speakers: e.Persons}
+				if err := f.add(day.Date, room.Name, t, e.Date, e.Start, e.Duration); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return f, nil
+}
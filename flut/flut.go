@@ -0,0 +1,160 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/SimonWaldherr/RGB-LED-Matrix/config"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/health"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/mqtt"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/overlay"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/panel"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/pixelflut"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/text"
+)
+
+var hardware = config.MatrixFlags(flag.CommandLine)
+var settings = panel.Flags(flag.CommandLine)
+var broker = mqtt.Flags(flag.CommandLine, "flut")
+
+var (
+	setfps      int
+	setlisten   string
+	setrate     int
+	setmaxconns int
+	setmaxperip int
+	setidle     time.Duration
+	setbinary   bool
+	setgoodbye  string
+	setgoodbyet time.Duration
+	sethealth   string
+	setstale    time.Duration
+	setfifo     string
+	setstdin    bool
+	setovertime time.Duration
+)
+
+func fatal(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+var out *panel.Output
+var panels *panel.Panels
+var monitor *health.Monitor
+var messages *overlay.Overlay
+var reloader *config.Reloader
+var remote *mqtt.Client
+
+// server takes the pixels from the network, the render loop shows its
+// canvas at a steady rate however fast they come in.
+var server *pixelflut.Server
+
+func main() {
+	flag.IntVar(&setfps, "f", 30, "frames per second")
+	flag.StringVar(&setlisten, "listen", ":1234", "TCP address of the Pixelflut server")
+	flag.IntVar(&setrate, "rate", 200000, "commands per second per connection, 0 for no limit")
+	flag.IntVar(&setmaxconns, "max-conns", 4096, "maximum number of connections, 0 for no limit")
+	flag.IntVar(&setmaxperip, "max-per-ip", 64, "maximum number of connections per client address, 0 for no limit")
+	flag.DurationVar(&setidle, "idle", 2*time.Minute, "close connections silent for this long, 0 keeps them")
+	flag.BoolVar(&setbinary, "binary", false, "accept the binary PB command")
+
+	flag.StringVar(&setgoodbye, "goodbye", "", "image shown when stopped with SIGINT or SIGTERM, empty for black")
+	flag.DurationVar(&setgoodbyet, "goodbye-time", 2*time.Second, "how long the goodbye image is shown")
+	flag.StringVar(&sethealth, "health", "", "address for the /healthz and /metrics endpoints, e.g. localhost:9100")
+	flag.DurationVar(&setstale, "health-stale", 30*time.Second, "time without a rendered frame after which the program counts as hung")
+	flag.StringVar(&setfifo, "fifo", "", "named pipe for text, color, image and clear commands, e.g. /run/ledmatrix.fifo")
+	flag.BoolVar(&setstdin, "stdin", false, "read overlay commands from stdin")
+	flag.DurationVar(&setovertime, "overlay-timeout", 0, "hide overlay messages after this time, 0 keeps them")
+
+	fatal(config.Parse("flut"))
+	reloader = config.Watch()
+
+	var err error
+	panels, err = panel.NewPanels(hardware, settings)
+	fatal(err)
+	goodbye, err := panel.LoadGoodbye(setgoodbye, setgoodbyet)
+	fatal(err)
+
+	server = pixelflut.NewServer(pixelflut.NewCanvas(panel.Width, panel.Height))
+	server.Rate = setrate
+	server.MaxConns = setmaxconns
+	server.MaxPerIP = setmaxperip
+	server.Idle = setidle
+	server.Binary = setbinary
+
+	panel.HandleSignals(goodbye, func() { remote.Close() }, server.Close)
+	monitor = health.New(setstale)
+	panels.Monitor = monitor
+	monitor.Gauge("ledmatrix_brightness_percent", "Brightness after dimming.", func() float64 { return float64(panels.Dimmer.Level()) })
+	monitor.Gauge("ledmatrix_pixelflut_connections", "Connected Pixelflut clients.", func() float64 { return float64(server.Connections()) })
+	monitor.Gauge("ledmatrix_pixelflut_pixels", "Pixels set by Pixelflut clients since the start.", func() float64 { return float64(server.Pixels()) })
+	if sethealth != "" {
+		monitor.Serve(sethealth)
+	}
+	monitor.Watchdog()
+	messages = overlay.New(text.Face7x13, setovertime)
+	if setfifo != "" {
+		fatal(messages.ListenFIFO(setfifo))
+	}
+	if setstdin {
+		go messages.Listen(os.Stdin)
+	}
+
+	fatal(server.Listen(setlisten))
+
+	if broker.Broker != "" {
+		remote = mqtt.Connect(*broker, mqtt.Handlers{
+			Level:   func(level int) { panels.Dimmer.Override(level, 0) },
+			Release: func() { panels.Dimmer.ClearOverride() },
+			Scene:   reloader.SetScene,
+			Scenes:  reloader.Scenes,
+			Current: reloader.Scene,
+			Text:    func(s string) error { return messages.Exec("text " + s) },
+			Image:   func(path string) error { return messages.Exec("image " + path) },
+		})
+	}
+
+	pacer := time.NewTicker(time.Second / time.Duration(max(1, setfps)))
+	defer pacer.Stop()
+
+	panel.Supervise("pixelflut", func() error {
+		var err error
+		if out, err = panels.Open(); err != nil {
+			return err
+		}
+		defer out.Close()
+		out.Overlay = messages
+
+		for range pacer.C {
+			reload()
+			server.Canvas.Draw(out.Frame())
+			if err := out.Render(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// reload applies changed settings between two frames. The panels are
+// only opened again for new hardware settings, everything else changes
+// in place. Broken settings are logged and the old ones stay in effect.
+// The limits of the server only change with a restart.
+func reload() {
+	changed := reloader.Reload()
+	if changed == nil {
+		return
+	}
+	panels.Reload(changed)
+	if changed.Scenes {
+		remote.Announce()
+	}
+
+	if changed.Has("overlay-timeout") {
+		messages.SetTimeout(setovertime)
+	}
+}
@@ -0,0 +1,329 @@
+// Package framecache decodes animated GIFs and still images (PNG, JPEG)
+// once and keeps every frame composited and scaled to the panel size, so
+// playback only has to copy pixels to the canvas.
+package framecache
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/SimonWaldherr/RGB-LED-Matrix/scale"
+)
+
+// cacheVersion is stored in every cache file, bump it whenever the
+// on-disk format or the scaling changes.
+const cacheVersion = 2
+
+// MaxPixels limits the size of the images that are decoded, so a
+// corrupt or hostile header can't exhaust the memory.
+var MaxPixels = 4096 * 4096
+
+// Frame is a single panel-ready image and the time it stays on screen.
+// Still images consist of one frame without a delay.
+type Frame struct {
+	Image *image.RGBA
+	Delay time.Duration
+}
+
+// Animation holds all frames of a decoded file at the target size.
+type Animation struct {
+	Width  int
+	Height int
+	Frames []Frame
+}
+
+// Still reports whether the animation is a single image.
+func (a *Animation) Still() bool {
+	return len(a.Frames) == 1
+}
+
+// DefaultMaxBytes is the memory New allows for decoded frames, about a
+// thousand frames of 128x128 pixels.
+const DefaultMaxBytes = 64 << 20
+
+// Cache decodes and scales animations for a fixed target size. Results
+// are kept in memory by path, size and modification time of the file,
+// and, if Dir is set, on disk keyed by the file hash, the target size
+// and the scaling policy.
+type Cache struct {
+	Width  int
+	Height int
+	Dir    string
+	Policy scale.Policy
+	// MaxBytes bounds the pixels kept in memory, the least recently
+	// used animations are dropped first. 0 keeps everything.
+	MaxBytes int
+
+	mu    sync.Mutex
+	mem   map[string]*list.Element
+	lru   *list.List
+	bytes int
+}
+
+// entry is an animation in memory.
+type entry struct {
+	key   string
+	anim  *Animation
+	bytes int
+}
+
+// New returns a cache for frames of width x height pixels, stretched
+// until Policy is set. An empty dir disables the on-disk cache.
+func New(width, height int, dir string) *Cache {
+	return &Cache{
+		Width:    width,
+		Height:   height,
+		Dir:      dir,
+		MaxBytes: DefaultMaxBytes,
+		mem:      make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Load returns the frames of filename. Unchanged files come from memory
+// without reading them, changed ones are hashed and decoded only if they
+// aren't on disk yet.
+func (c *Cache) Load(filename string) (*Animation, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	memKey := fmt.Sprintf("%s|%d|%d|%dx%d-%s", filename, info.Size(), info.ModTime().UnixNano(), c.Width, c.Height, c.Policy)
+	if anim, ok := c.get(memKey); ok {
+		return anim, nil
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	key := c.key(data)
+	anim, err := c.readDisk(key)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("framecache: ignoring %s: %v", c.path(key), err)
+		}
+		anim, err = c.decode(filename, data)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.writeDisk(key, anim); err != nil {
+			log.Printf("framecache: %v", err)
+		}
+	}
+
+	c.put(memKey, anim)
+	return anim, nil
+}
+
+// get returns the animation for key from memory and marks it as used.
+func (c *Cache) get(key string) (*Animation, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.mem[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*entry).anim, true
+}
+
+// put keeps anim in memory, dropping the least recently used animations
+// beyond MaxBytes. The newest one always stays.
+func (c *Cache) put(key string, anim *Animation) {
+	size := 0
+	for _, f := range anim.Frames {
+		size += len(f.Image.Pix)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.mem[key]; ok {
+		c.remove(e)
+	}
+	c.mem[key] = c.lru.PushFront(&entry{key: key, anim: anim, bytes: size})
+	c.bytes += size
+	for c.MaxBytes > 0 && c.bytes > c.MaxBytes && c.lru.Len() > 1 {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *Cache) remove(e *list.Element) {
+	en := e.Value.(*entry)
+	c.lru.Remove(e)
+	delete(c.mem, en.key)
+	c.bytes -= en.bytes
+}
+
+func (c *Cache) key(data []byte) string {
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("%s-%dx%d-%s", hex.EncodeToString(sum[:]), c.Width, c.Height, c.Policy)
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, key+".frames")
+}
+
+func (c *Cache) decode(filename string, data []byte) (anim *Animation, err error) {
+	// a broken file must not take the wall down
+	defer func() {
+		if r := recover(); r != nil {
+			anim, err = nil, fmt.Errorf("%s: corrupt image: %v", filename, r)
+		}
+	}()
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, fmt.Errorf("%s: %dx%d pixels is too large", filename, config.Width, config.Height)
+	}
+
+	if format != "gif" {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		frame := Frame{Image: c.Policy.Scale(img, c.Width, c.Height)}
+		return &Animation{Width: c.Width, Height: c.Height, Frames: []Frame{frame}}, nil
+	}
+
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if len(g.Image) == 0 {
+		return nil, fmt.Errorf("%s: no frames", filename)
+	}
+	return Composite(g, c.Width, c.Height, c.Policy), nil
+}
+
+// Composite renders the frames of g onto a full-size canvas, honouring
+// the disposal method of every frame, and scales every rendered frame to
+// width x height following policy. GIF frames are often only the
+// rectangle that changed, so they can't be scaled on their own. Only the
+// scaled frames are kept, so a long animation doesn't take the memory of
+// all its frames at full size.
+func Composite(g *gif.GIF, width, height int, policy scale.Policy) *Animation {
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() {
+		bounds = g.Image[0].Bounds()
+		for _, img := range g.Image[1:] {
+			bounds = bounds.Union(img.Bounds())
+		}
+	}
+
+	canvas := image.NewRGBA(bounds)
+	anim := &Animation{Width: width, Height: height, Frames: make([]Frame, 0, len(g.Image))}
+	for i, img := range g.Image {
+		var previous *image.RGBA
+		disposal := byte(0)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(bounds)
+			copy(previous.Pix, canvas.Pix)
+		}
+
+		draw.Draw(canvas, img.Bounds(), img, img.Bounds().Min, draw.Over)
+
+		delay := time.Duration(0)
+		if i < len(g.Delay) {
+			delay = time.Duration(g.Delay[i]*10) * time.Millisecond
+		}
+		anim.Frames = append(anim.Frames, Frame{Image: policy.Scale(canvas, width, height), Delay: delay})
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, img.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return anim
+}
+
+type diskFrames struct {
+	Version int
+	Width   int
+	Height  int
+	Delays  []time.Duration
+	Pix     [][]byte
+}
+
+func (c *Cache) readDisk(key string) (*Animation, error) {
+	if c.Dir == "" {
+		return nil, os.ErrNotExist
+	}
+	file, err := os.Open(c.path(key))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var df diskFrames
+	if err := gob.NewDecoder(file).Decode(&df); err != nil {
+		return nil, err
+	}
+	if df.Version != cacheVersion || df.Width != c.Width || df.Height != c.Height || len(df.Delays) != len(df.Pix) {
+		return nil, fmt.Errorf("stale cache file")
+	}
+
+	anim := &Animation{Width: df.Width, Height: df.Height, Frames: make([]Frame, len(df.Pix))}
+	for i, pix := range df.Pix {
+		img := image.NewRGBA(image.Rect(0, 0, df.Width, df.Height))
+		if len(pix) != len(img.Pix) {
+			return nil, fmt.Errorf("frame %d has %d bytes, want %d", i, len(pix), len(img.Pix))
+		}
+		copy(img.Pix, pix)
+		anim.Frames[i] = Frame{Image: img, Delay: df.Delays[i]}
+	}
+	return anim, nil
+}
+
+func (c *Cache) writeDisk(key string, anim *Animation) error {
+	if c.Dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return err
+	}
+
+	df := diskFrames{Version: cacheVersion, Width: anim.Width, Height: anim.Height}
+	for _, f := range anim.Frames {
+		df.Delays = append(df.Delays, f.Delay)
+		df.Pix = append(df.Pix, f.Image.Pix)
+	}
+
+	// write to a temporary file first so a crash never leaves a
+	// truncated cache file behind
+	tmp, err := os.CreateTemp(c.Dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(tmp).Encode(&df); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(key))
+}
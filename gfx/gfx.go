@@ -0,0 +1,203 @@
+// Package gfx draws lines, shapes and gradients onto an image.RGBA.
+//
+// Everything blends with the alpha of its color, so translucent shapes
+// can be layered. Functions taking float64 coordinates are anti-aliased,
+// with pixel centers at whole numbers; the ones taking ints draw hard
+// pixels. Anything outside the image is clipped.
+package gfx
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Point is a position with sub-pixel precision.
+type Point struct {
+	X, Y float64
+}
+
+// Pt is shorthand for Point{x, y}.
+func Pt(x, y float64) Point {
+	return Point{x, y}
+}
+
+// Blend blends col with the coverage 0 to 1 into the pixel x, y.
+func Blend(img *image.RGBA, x, y int, col color.Color, coverage float64) {
+	if coverage <= 0 || !(image.Point{x, y}.In(img.Rect)) {
+		return
+	}
+	if coverage > 1 {
+		coverage = 1
+	}
+	r, g, b, a := col.RGBA()
+	f := uint32(coverage * 0xffff)
+	sr, sg, sb, sa := r*f/0xffff, g*f/0xffff, b*f/0xffff, a*f/0xffff
+
+	i := img.PixOffset(x, y)
+	dst := img.Pix[i : i+4 : i+4]
+	ia := 0xffff - sa
+	dst[0] = uint8((uint32(dst[0])*0x101*ia/0xffff + sr) >> 8)
+	dst[1] = uint8((uint32(dst[1])*0x101*ia/0xffff + sg) >> 8)
+	dst[2] = uint8((uint32(dst[2])*0x101*ia/0xffff + sb) >> 8)
+	dst[3] = uint8((uint32(dst[3])*0x101*ia/0xffff + sa) >> 8)
+}
+
+// Lerp mixes c0 and c1, t from 0 (c0) to 1 (c1).
+func Lerp(c0, c1 color.RGBA, t float64) color.RGBA {
+	t = math.Max(0, math.Min(1, t))
+	mix := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a) + (float64(b)-float64(a))*t))
+	}
+	return color.RGBA{mix(c0.R, c1.R), mix(c0.G, c1.G), mix(c0.B, c1.B), mix(c0.A, c1.A)}
+}
+
+// Line draws a one pixel line from x1, y1 to x2, y2 without smoothing
+// (Bresenham).
+func Line(img *image.RGBA, x1, y1, x2, y2 int, col color.Color) {
+	dx, dy := abs(x2-x1), -abs(y2-y1)
+	sx, sy := 1, 1
+	if x1 > x2 {
+		sx = -1
+	}
+	if y1 > y2 {
+		sy = -1
+	}
+	err := dx + dy
+	for {
+		Blend(img, x1, y1, col, 1)
+		if x1 == x2 && y1 == y2 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x1 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y1 += sy
+		}
+	}
+}
+
+// WuLine draws an anti-aliased line one pixel wide (Xiaolin Wu).
+func WuLine(img *image.RGBA, x1, y1, x2, y2 float64, col color.Color) {
+	steep := math.Abs(y2-y1) > math.Abs(x2-x1)
+	if steep {
+		x1, y1 = y1, x1
+		x2, y2 = y2, x2
+	}
+	if x1 > x2 {
+		x1, x2 = x2, x1
+		y1, y2 = y2, y1
+	}
+
+	plot := func(x, y int, c float64) {
+		if steep {
+			x, y = y, x
+		}
+		Blend(img, x, y, col, c)
+	}
+
+	dx, dy := x2-x1, y2-y1
+	gradient := 1.0
+	if dx != 0 {
+		gradient = dy / dx
+	}
+
+	// first end point
+	xend := math.Round(x1)
+	yend := y1 + gradient*(xend-x1)
+	xgap := 1 - frac(x1+0.5)
+	xpxl1, ypxl1 := int(xend), int(math.Floor(yend))
+	plot(xpxl1, ypxl1, (1-frac(yend))*xgap)
+	plot(xpxl1, ypxl1+1, frac(yend)*xgap)
+	intery := yend + gradient
+
+	// second end point
+	xend = math.Round(x2)
+	yend = y2 + gradient*(xend-x2)
+	xgap = frac(x2 + 0.5)
+	xpxl2, ypxl2 := int(xend), int(math.Floor(yend))
+	plot(xpxl2, ypxl2, (1-frac(yend))*xgap)
+	plot(xpxl2, ypxl2+1, frac(yend)*xgap)
+
+	for x := xpxl1 + 1; x < xpxl2; x++ {
+		y := int(math.Floor(intery))
+		plot(x, y, 1-frac(intery))
+		plot(x, y+1, frac(intery))
+		intery += gradient
+	}
+}
+
+// ThickLine draws an anti-aliased line of width with round caps. Lines
+// up to one pixel wide are drawn with WuLine.
+func ThickLine(img *image.RGBA, x1, y1, x2, y2 float64, col color.Color, width float64) {
+	if width <= 1 {
+		WuLine(img, x1, y1, x2, y2, col)
+		return
+	}
+
+	// coverage of every pixel from its distance to the segment
+	r := width / 2
+	bounds := image.Rect(
+		int(math.Floor(math.Min(x1, x2)-r)), int(math.Floor(math.Min(y1, y2)-r)),
+		int(math.Ceil(math.Max(x1, x2)+r))+1, int(math.Ceil(math.Max(y1, y2)+r))+1,
+	).Intersect(img.Rect)
+	for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
+		for px := bounds.Min.X; px < bounds.Max.X; px++ {
+			d := segmentDistance(Pt(float64(px), float64(py)), Pt(x1, y1), Pt(x2, y2))
+			Blend(img, px, py, col, r+0.5-d)
+		}
+	}
+}
+
+// Polyline draws connected lines through points.
+func Polyline(img *image.RGBA, points []Point, col color.Color, width float64) {
+	if width <= 1 {
+		for i := 1; i < len(points); i++ {
+			WuLine(img, points[i-1].X, points[i-1].Y, points[i].X, points[i].Y, col)
+		}
+		return
+	}
+	// one pass over the union of the segments, so joints aren't blended
+	// twice
+	r := width / 2
+	bounds := image.Rectangle{}
+	for _, p := range points {
+		bounds = bounds.Union(image.Rect(int(math.Floor(p.X-r)), int(math.Floor(p.Y-r)), int(math.Ceil(p.X+r))+1, int(math.Ceil(p.Y+r))+1))
+	}
+	bounds = bounds.Intersect(img.Rect)
+	for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
+		for px := bounds.Min.X; px < bounds.Max.X; px++ {
+			p := Pt(float64(px), float64(py))
+			d := math.Inf(1)
+			for i := 1; i < len(points); i++ {
+				d = math.Min(d, segmentDistance(p, points[i-1], points[i]))
+			}
+			Blend(img, px, py, col, r+0.5-d)
+		}
+	}
+}
+
+// segmentDistance returns the distance of p to the segment a, b.
+func segmentDistance(p, a, b Point) float64 {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	t := 0.0
+	if lenSq := dx*dx + dy*dy; lenSq > 0 {
+		t = math.Max(0, math.Min(1, ((p.X-a.X)*dx+(p.Y-a.Y)*dy)/lenSq))
+	}
+	return math.Hypot(p.X-(a.X+t*dx), p.Y-(a.Y+t*dy))
+}
+
+func frac(x float64) float64 {
+	return x - math.Floor(x)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,39 @@
+package gfx
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// LinearGradient fills r with a gradient from c0 at p0 to c1 at p1,
+// constant beyond both ends.
+func LinearGradient(img *image.RGBA, r image.Rectangle, p0, p1 Point, c0, c1 color.RGBA) {
+	dx, dy := p1.X-p0.X, p1.Y-p0.Y
+	lenSq := dx*dx + dy*dy
+	r = r.Intersect(img.Rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			t := 0.0
+			if lenSq > 0 {
+				t = ((float64(x)-p0.X)*dx + (float64(y)-p0.Y)*dy) / lenSq
+			}
+			Blend(img, x, y, Lerp(c0, c1, t), 1)
+		}
+	}
+}
+
+// RadialGradient fills r with a gradient from inner at cx, cy to outer
+// at radius and beyond.
+func RadialGradient(img *image.RGBA, r image.Rectangle, cx, cy, radius float64, inner, outer color.RGBA) {
+	r = r.Intersect(img.Rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			t := 1.0
+			if radius > 0 {
+				t = math.Hypot(float64(x)-cx, float64(y)-cy) / radius
+			}
+			Blend(img, x, y, Lerp(inner, outer, t), 1)
+		}
+	}
+}
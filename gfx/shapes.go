@@ -0,0 +1,183 @@
+package gfx
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+)
+
+// Rect draws the outline of r, one pixel inside it.
+func Rect(img *image.RGBA, r image.Rectangle, col color.Color) {
+	r = r.Canon()
+	if r.Empty() {
+		return
+	}
+	FillRect(img, image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+1), col)
+	FillRect(img, image.Rect(r.Min.X, r.Max.Y-1, r.Max.X, r.Max.Y), col)
+	FillRect(img, image.Rect(r.Min.X, r.Min.Y+1, r.Min.X+1, r.Max.Y-1), col)
+	FillRect(img, image.Rect(r.Max.X-1, r.Min.Y+1, r.Max.X, r.Max.Y-1), col)
+}
+
+// FillRect fills r.
+func FillRect(img *image.RGBA, r image.Rectangle, col color.Color) {
+	draw.Draw(img, r, image.NewUniform(col), image.Point{}, draw.Over)
+}
+
+// Circle draws the outline of a circle with radius r around cx, cy
+// (midpoint algorithm).
+func Circle(img *image.RGBA, cx, cy, r int, col color.Color) {
+	if r < 0 {
+		return
+	}
+	// every pixel once, the octants share their ends
+	seen := make(map[image.Point]bool)
+	plot := func(x, y int) {
+		for _, p := range [8]image.Point{{x, y}, {-x, y}, {x, -y}, {-x, -y}, {y, x}, {-y, x}, {y, -x}, {-y, -x}} {
+			if !seen[p] {
+				seen[p] = true
+				Blend(img, cx+p.X, cy+p.Y, col, 1)
+			}
+		}
+	}
+	x, y := 0, r
+	d := 3 - 2*r
+	for y >= x {
+		plot(x, y)
+		x++
+		if d > 0 {
+			y--
+			d += 4*(x-y) + 10
+		} else {
+			d += 4*x + 6
+		}
+	}
+}
+
+// FillCircle fills a circle with radius r around cx, cy.
+func FillCircle(img *image.RGBA, cx, cy, r int, col color.Color) {
+	for y := -r; y <= r; y++ {
+		for x := -r; x <= r; x++ {
+			if x*x+y*y <= r*r+r {
+				Blend(img, cx+x, cy+y, col, 1)
+			}
+		}
+	}
+}
+
+// Ellipse draws the anti-aliased outline of an ellipse with the radii
+// rx, ry around cx, cy, width pixels wide.
+func Ellipse(img *image.RGBA, cx, cy, rx, ry float64, col color.Color, width float64) {
+	half := math.Max(width, 1) / 2
+	ellipse(img, cx, cy, rx+half, ry+half, col, func(px, py float64) float64 {
+		d := ellipseDistance(px-cx, py-cy, rx, ry)
+		return half + 0.5 - math.Abs(d)
+	})
+}
+
+// FillEllipse fills an anti-aliased ellipse with the radii rx, ry
+// around cx, cy. With rx == ry it is a smooth circle.
+func FillEllipse(img *image.RGBA, cx, cy, rx, ry float64, col color.Color) {
+	ellipse(img, cx, cy, rx, ry, col, func(px, py float64) float64 {
+		return 0.5 - ellipseDistance(px-cx, py-cy, rx, ry)
+	})
+}
+
+// ellipse runs coverage over the bounding box and blends the result.
+func ellipse(img *image.RGBA, cx, cy, rx, ry float64, col color.Color, coverage func(px, py float64) float64) {
+	bounds := image.Rect(int(math.Floor(cx-rx-1)), int(math.Floor(cy-ry-1)), int(math.Ceil(cx+rx+1))+1, int(math.Ceil(cy+ry+1))+1).Intersect(img.Rect)
+	for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
+		for px := bounds.Min.X; px < bounds.Max.X; px++ {
+			Blend(img, px, py, col, coverage(float64(px), float64(py)))
+		}
+	}
+}
+
+// ellipseDistance approximates the signed distance of x, y from the
+// ellipse, negative inside.
+func ellipseDistance(x, y, rx, ry float64) float64 {
+	if rx <= 0 || ry <= 0 {
+		return math.Hypot(x, y)
+	}
+	k := math.Hypot(x/rx, y/ry)
+	if k == 0 {
+		return -math.Min(rx, ry)
+	}
+	// first order: the value of the implicit function over its gradient
+	grad := math.Hypot(x/(rx*rx), y/(ry*ry))
+	return (k - 1) * k / grad
+}
+
+// Arc draws an anti-aliased arc of a circle with radius r around cx, cy
+// from the angle start to end in degrees, clockwise from 12 o'clock
+// like the hands of a clock.
+func Arc(img *image.RGBA, cx, cy, r, start, end float64, col color.Color, width float64) {
+	for end < start {
+		end += 360
+	}
+	sweep := end - start
+	half := math.Max(width, 1) / 2
+	bounds := image.Rect(int(math.Floor(cx-r-half-1)), int(math.Floor(cy-r-half-1)), int(math.Ceil(cx+r+half+1))+1, int(math.Ceil(cy+r+half+1))+1).Intersect(img.Rect)
+	at := func(angle float64) Point {
+		rad := (angle - 90) * math.Pi / 180
+		return Pt(cx+r*math.Cos(rad), cy+r*math.Sin(rad))
+	}
+	a, b := at(start), at(end)
+	for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
+		for px := bounds.Min.X; px < bounds.Max.X; px++ {
+			dx, dy := float64(px)-cx, float64(py)-cy
+			angle := math.Mod(math.Atan2(dy, dx)*180/math.Pi+90-start+720, 360)
+			var d float64
+			if angle <= sweep {
+				d = math.Abs(math.Hypot(dx, dy) - r)
+			} else {
+				// beyond the ends the distance to the round caps
+				p := Pt(float64(px), float64(py))
+				d = math.Min(math.Hypot(p.X-a.X, p.Y-a.Y), math.Hypot(p.X-b.X, p.Y-b.Y))
+			}
+			Blend(img, px, py, col, half+0.5-d)
+		}
+	}
+}
+
+// Polygon draws the anti-aliased outline of the closed polygon through
+// points.
+func Polygon(img *image.RGBA, points []Point, col color.Color, width float64) {
+	if len(points) < 2 {
+		return
+	}
+	Polyline(img, append(append([]Point(nil), points...), points[0]), col, width)
+}
+
+// FillPolygon fills the polygon through points with the even-odd rule,
+// sampling every pixel at its center.
+func FillPolygon(img *image.RGBA, points []Point, col color.Color) {
+	if len(points) < 3 {
+		return
+	}
+	minY, maxY := points[0].Y, points[0].Y
+	for _, p := range points {
+		minY, maxY = math.Min(minY, p.Y), math.Max(maxY, p.Y)
+	}
+	top := max(img.Rect.Min.Y, int(math.Ceil(minY)))
+	bottom := min(img.Rect.Max.Y-1, int(math.Floor(maxY)))
+
+	var xs []float64
+	for y := top; y <= bottom; y++ {
+		fy := float64(y)
+		xs = xs[:0]
+		for i := range points {
+			a, b := points[i], points[(i+1)%len(points)]
+			if (a.Y <= fy) != (b.Y <= fy) {
+				xs = append(xs, a.X+(fy-a.Y)/(b.Y-a.Y)*(b.X-a.X))
+			}
+		}
+		sort.Float64s(xs)
+		for i := 0; i+1 < len(xs); i += 2 {
+			for x := int(math.Ceil(xs[i])); x <= int(math.Floor(xs[i+1])); x++ {
+				Blend(img, x, y, col, 1)
+			}
+		}
+	}
+}
@@ -0,0 +1,218 @@
+// Package health keeps track of the render loop for unattended
+// operation: when the last frame made it to the panels, how long frames
+// take and how much memory the process uses. It serves this on /healthz
+// and, in the Prometheus text format, on /metrics, and pings the systemd
+// watchdog as long as frames keep coming, so systemd restarts a hung
+// program.
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// frameBuckets are the upper bounds of the frame time histogram.
+var frameBuckets = []time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 20 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, time.Second,
+}
+
+// Monitor collects the statistics of the rendered frames. It implements
+// panel.Monitor.
+type Monitor struct {
+	// Stale is how long the panels may go without a frame before the
+	// program counts as hung.
+	Stale time.Duration
+
+	mu       sync.Mutex
+	start    time.Time
+	last     time.Time
+	frames   uint64
+	failures uint64
+	lastErr  error
+	buckets  []uint64
+	sum      time.Duration
+	max      time.Duration
+	current  float64
+	gauges   map[string]gauge
+}
+
+type gauge struct {
+	help  string
+	value func() float64
+}
+
+// New returns a monitor that reports the program as hung after stale
+// without a frame.
+func New(stale time.Duration) *Monitor {
+	return &Monitor{
+		Stale:   stale,
+		start:   time.Now(),
+		buckets: make([]uint64, len(frameBuckets)),
+		gauges:  make(map[string]gauge),
+	}
+}
+
+// Frame records a frame that took took to render with an estimated
+// current in amps, err is the error of the render if it failed.
+func (m *Monitor) Frame(took time.Duration, current float64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		m.failures++
+		m.lastErr = err
+		return
+	}
+	m.last = time.Now()
+	m.frames++
+	m.current = current
+	m.sum += took
+	m.max = max(m.max, took)
+	for i, b := range frameBuckets {
+		if took <= b {
+			m.buckets[i]++
+		}
+	}
+}
+
+// Gauge adds a metric that is read by calling value on every scrape,
+// like the brightness.
+func (m *Monitor) Gauge(name, help string, value func() float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gauges[name] = gauge{help, value}
+}
+
+// Healthy reports whether a frame was rendered within Stale, with the
+// reason if not. A program that just started gets Stale to render its
+// first frame.
+func (m *Monitor) Healthy() (ok bool, reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.healthy(time.Now())
+}
+
+func (m *Monitor) healthy(now time.Time) (bool, string) {
+	if m.Stale <= 0 {
+		return true, ""
+	}
+	if m.last.IsZero() {
+		if now.Sub(m.start) < m.Stale {
+			return true, ""
+		}
+		if m.lastErr != nil {
+			return false, fmt.Sprintf("no frame since the start, last error: %v", m.lastErr)
+		}
+		return false, "no frame since the start"
+	}
+	if age := now.Sub(m.last); age >= m.Stale {
+		reason := fmt.Sprintf("no frame for %v", age.Round(time.Second))
+		if m.lastErr != nil {
+			reason += fmt.Sprintf(", last error: %v", m.lastErr)
+		}
+		return false, reason
+	}
+	return true, ""
+}
+
+// status is the answer of /healthz.
+type status struct {
+	Status       string  `json:"status"`
+	Reason       string  `json:"reason,omitempty"`
+	LastFrame    string  `json:"last_frame,omitempty"`
+	LastFrameAge float64 `json:"last_frame_age_seconds"`
+	Frames       uint64  `json:"frames"`
+	Failures     uint64  `json:"failures"`
+	LastError    string  `json:"last_error,omitempty"`
+	AvgFrameTime float64 `json:"avg_frame_seconds"`
+	MaxFrameTime float64 `json:"max_frame_seconds"`
+	Uptime       float64 `json:"uptime_seconds"`
+	HeapBytes    uint64  `json:"heap_bytes"`
+	Goroutines   int     `json:"goroutines"`
+	CurrentAmps  float64 `json:"current_amps"`
+	StaleAfter   float64 `json:"stale_after_seconds"`
+}
+
+func (m *Monitor) status() status {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	ok, reason := m.healthy(now)
+	s := status{
+		Status:       "ok",
+		Reason:       reason,
+		Frames:       m.frames,
+		Failures:     m.failures,
+		MaxFrameTime: m.max.Seconds(),
+		Uptime:       now.Sub(m.start).Seconds(),
+		HeapBytes:    mem.HeapAlloc,
+		Goroutines:   runtime.NumGoroutine(),
+		CurrentAmps:  m.current,
+		StaleAfter:   m.Stale.Seconds(),
+	}
+	if !ok {
+		s.Status = "stale"
+	}
+	if !m.last.IsZero() {
+		s.LastFrame = m.last.Format(time.RFC3339Nano)
+		s.LastFrameAge = now.Sub(m.last).Seconds()
+	}
+	if m.lastErr != nil {
+		s.LastError = m.lastErr.Error()
+	}
+	if m.frames > 0 {
+		s.AvgFrameTime = m.sum.Seconds() / float64(m.frames)
+	}
+	return s
+}
+
+// Handler serves /healthz, which answers 503 when the program is hung,
+// and /metrics.
+func (m *Monitor) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		s := m.status()
+		w.Header().Set("Content-Type", "application/json")
+		if s.Status != "ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(s)
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.WriteMetrics(w)
+	})
+	return mux
+}
+
+// Serve serves Handler on addr in the background, like localhost:9100.
+func (m *Monitor) Serve(addr string) {
+	go func() {
+		log.Printf("health: serving http://%s/healthz and /metrics", addr)
+		if err := http.ListenAndServe(addr, m.Handler()); err != nil {
+			log.Printf("health: %v", err)
+		}
+	}()
+}
+
+// names returns the names of the extra gauges in order.
+func (m *Monitor) names() []string {
+	names := make([]string, 0, len(m.gauges))
+	for name := range m.gauges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
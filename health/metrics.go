@@ -0,0 +1,87 @@
+package health
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// WriteMetrics writes the statistics in the Prometheus text format.
+func (m *Monitor) WriteMetrics(w io.Writer) error {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	m.mu.Lock()
+	now := time.Now()
+	ok, _ := m.healthy(now)
+	buckets := append([]uint64(nil), m.buckets...)
+	frames, failures, sum, longest, current := m.frames, m.failures, m.sum, m.max, m.current
+	last, start := m.last, m.start
+	gauges := make([]gauge, 0, len(m.gauges))
+	names := m.names()
+	for _, name := range names {
+		gauges = append(gauges, m.gauges[name])
+	}
+	m.mu.Unlock()
+
+	p := &printer{w: w}
+	p.metric("ledmatrix_healthy", "gauge", "1 if a frame was rendered recently.", boolValue(ok))
+	p.metric("ledmatrix_frames_total", "counter", "Frames rendered to the panels.", float64(frames))
+	p.metric("ledmatrix_frame_errors_total", "counter", "Frames that failed to render.", float64(failures))
+	if !last.IsZero() {
+		p.metric("ledmatrix_last_frame_timestamp_seconds", "gauge", "Unix time of the last rendered frame.", float64(last.UnixNano())/1e9)
+	}
+
+	p.header("ledmatrix_frame_duration_seconds", "histogram", "Time to render a frame.")
+	for i, b := range frameBuckets {
+		p.line(`ledmatrix_frame_duration_seconds_bucket{le="`+strconv.FormatFloat(b.Seconds(), 'g', -1, 64)+`"}`, float64(buckets[i]))
+	}
+	p.line(`ledmatrix_frame_duration_seconds_bucket{le="+Inf"}`, float64(frames))
+	p.line("ledmatrix_frame_duration_seconds_sum", sum.Seconds())
+	p.line("ledmatrix_frame_duration_seconds_count", float64(frames))
+	p.metric("ledmatrix_frame_duration_max_seconds", "gauge", "Longest time to render a frame.", longest.Seconds())
+
+	p.metric("ledmatrix_current_amps", "gauge", "Estimated current of the last frame.", current)
+	p.metric("ledmatrix_uptime_seconds", "gauge", "Time since the program started.", now.Sub(start).Seconds())
+	p.metric("ledmatrix_memory_heap_bytes", "gauge", "Bytes of allocated heap objects.", float64(mem.HeapAlloc))
+	p.metric("ledmatrix_memory_sys_bytes", "gauge", "Bytes of memory obtained from the system.", float64(mem.Sys))
+	p.metric("ledmatrix_gc_total", "counter", "Completed garbage collections.", float64(mem.NumGC))
+	p.metric("ledmatrix_goroutines", "gauge", "Number of goroutines.", float64(runtime.NumGoroutine()))
+
+	for i, g := range gauges {
+		p.metric(names[i], "gauge", g.help, g.value())
+	}
+	return p.err
+}
+
+// printer writes metrics and keeps the first error.
+type printer struct {
+	w   io.Writer
+	err error
+}
+
+func (p *printer) header(name, kind, help string) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+}
+
+func (p *printer) line(name string, value float64) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, "%s %s\n", name, strconv.FormatFloat(value, 'g', -1, 64))
+	}
+}
+
+func (p *printer) metric(name, kind, help string, value float64) {
+	p.header(name, kind, help)
+	p.line(name, value)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
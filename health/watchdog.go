@@ -0,0 +1,67 @@
+package health
+
+import (
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Notify sends state, like READY=1, to systemd over $NOTIFY_SOCKET. It
+// does nothing if the program wasn't started by systemd with
+// Type=notify or a watchdog.
+func Notify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if socket[0] == '@' {
+		// abstract namespace
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// Watchdog tells systemd the program is ready and, if the unit has
+// WatchdogSec set, pings the watchdog at half that interval as long as
+// the monitor is healthy. When the render loop hangs the pings stop and
+// systemd restarts the program.
+func (m *Monitor) Watchdog() {
+	if err := Notify("READY=1"); err != nil {
+		log.Printf("health: sd_notify: %v", err)
+		return
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return
+	}
+	interval := time.Duration(usec) * time.Microsecond / 2
+	log.Printf("health: pinging the systemd watchdog every %v", interval)
+	go func() {
+		stalled := false
+		for range time.Tick(interval) {
+			ok, reason := m.Healthy()
+			if !ok {
+				if !stalled {
+					log.Printf("health: not pinging the watchdog, %s", reason)
+				}
+				stalled = true
+				continue
+			}
+			stalled = false
+			if err := Notify("WATCHDOG=1"); err != nil {
+				log.Printf("health: sd_notify: %v", err)
+			}
+		}
+	}()
+}
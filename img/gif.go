@@ -2,26 +2,27 @@ package main
 
 import (
 	"flag"
-	"fmt"
-	"image/color"
-	"image/gif"
 	"image"
-	//"image/draw"
 	"log"
 	"math/rand"
 	"os"
 	"time"
 
-	rgbmatrix "simonwaldherr.de/go/rpirgbled"
-	"golang.org/x/image/draw"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/compositor"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/config"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/framecache"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/health"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/mqtt"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/overlay"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/panel"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/scale"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/text"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/transition"
 )
 
-var (
-	rows       = flag.Int("led-rows", 32, "number of rows supported")
-	parallel   = flag.Int("led-parallel", 1, "number of daisy-chained panels")
-	chain      = flag.Int("led-chain", 16, "number of displays daisy-chained")
-	brightness = flag.Int("brightness", 99, "brightness (0-100)")
-)
+var hardware = config.MatrixFlags(flag.CommandLine)
+var settings = panel.Flags(flag.CommandLine)
+var broker = mqtt.Flags(flag.CommandLine, "gif")
 
 type Field struct {
 	cells  [][]int
@@ -40,11 +41,26 @@ var (
 	setfilename  string
 	outputfile   string
 	port         string
+	setgoodbye   string
+	setgoodbyet  time.Duration
+	sethealth    string
+	setstale     time.Duration
+	cachedir     string
+	setscale     string
+	setgravity   string
+	setfilter    string
+	setbg        string
+	setfifo      string
+	setstdin     bool
+	setovertime  time.Duration
+	setstatus    string
+	settrans     string
+	settranstime time.Duration
 )
 
 func fatal(err error) {
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
 	}
 }
 
@@ -64,84 +80,52 @@ func smallRandomUint() uint8 {
 	return uint8(rand.Intn(16))
 }
 
-func newXY(x, y int) (int, int) {
-	switch {
-	case y < 64:
-		switch {
-		case x < 32:
-			return 192 + y, 31 - x
-		case x < 64:
-			return 191 - y, x - 32
-		case x < 96:
-			return 64 + y, 31 - (x - 64)
-		case x < 128:
-			return 63 - y, x - 96
-		case x < 192:
-			return 0, 0
-		}
-	case y < 128:
-		yh := y - 64
-		switch {
-		case x < 32:
-			return 256 + yh, 31 - x
-		case x < 64:
-			return 383 - yh, x - 32
-		case x < 96:
-			return 384 + yh, 31 - (x - 64)
-		case x < 128:
-			return 511 - yh, x - 96
-		}
-	}
-	return 0, 0
-}
-
-func resizeImage(src image.Image, newWidth, newHeight int) image.Image {
-	dst := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
-	draw.ApproxBiLinear.Scale(dst, dst.Rect, src, src.Bounds(), draw.Over, nil)
-	return dst
-}
-
-func (field *Field) printField(setfilename string) string {
-	file, err := os.Open(setfilename)
+func (field *Field) printField(setfilename string) error {
+	anim, err := frames.Load(setfilename)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	defer file.Close()
-	
-	c.Clear()
-	
-	gif, _ := gif.DecodeAll(file)
-	
-	for i, srcImg := range gif.Image {
+
+	for i, frame := range anim.Frames {
 		start := time.Now() // Start time measurement
-		
-		// Skaliere das Bild auf 128x128
-		resizedImg := resizeImage(srcImg, 128, 128)
-		
-		for y := 0; y < field.height; y++ {
-			for x := 0; x < field.width; x++ {
-				x1, y1 := newXY(x, y)
-				pixel := resizedImg.At(x, y)
-				r, g, b, _ := pixel.RGBA()
-				c.Set(x1, y1, color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), 255})
-			}
+
+		if i == 0 && lastFrame != nil {
+			// blend the loop restart instead of flashing black
+			err = transition.Play(effect, lastFrame, frame.Image, settranstime, setfps, show)
+		} else {
+			err = show(frame.Image)
+		}
+		if err != nil {
+			return err
 		}
-		c.Render()
-		
+
 		elapsed := time.Since(start) // Calculate elapsed time
-		
-		if i < len(gif.Delay) {
-			delay := time.Duration(gif.Delay[i]*10) * time.Millisecond
-			if delay > elapsed {
-				time.Sleep(delay - elapsed) // Adjusted sleep time
-			}
+
+		if frame.Delay > elapsed {
+			time.Sleep(frame.Delay - elapsed) // Adjusted sleep time
 		}
 	}
-	return ""
+	lastFrame = anim.Frames[len(anim.Frames)-1].Image
+	return nil
 }
 
-var config = &rgbmatrix.DefaultConfig
-var c *rgbmatrix.Canvas
+// show renders one frame to the panels.
+func show(frame *image.RGBA) error {
+	reload()
+	out.Draw(frame)
+	return out.Render()
+}
+
+var out *panel.Output
+var panels *panel.Panels
+var monitor *health.Monitor
+var frames *framecache.Cache
+var messages *overlay.Overlay
+var layers *compositor.Compositor
+var effect transition.Effect
+var lastFrame *image.RGBA
+var reloader *config.Reloader
+var remote *mqtt.Client
 
 func main() {
 	flag.IntVar(&setwidth, "w", 128, "terminal width")
@@ -150,33 +134,130 @@ func main() {
 	flag.IntVar(&setfps, "f", 20, "frames per second")
 	flag.StringVar(&setfilename, "o", "./data.gif", "open file")
 	flag.IntVar(&outputlength, "l", 200, "frames")
+	flag.StringVar(&setgoodbye, "goodbye", "", "image shown when stopped with SIGINT or SIGTERM, empty for black")
+	flag.DurationVar(&setgoodbyet, "goodbye-time", 2*time.Second, "how long the goodbye image is shown")
+	flag.StringVar(&sethealth, "health", "", "address for the /healthz and /metrics endpoints, e.g. localhost:9100")
+	flag.DurationVar(&setstale, "health-stale", 30*time.Second, "time without a rendered frame after which the program counts as hung")
+	flag.StringVar(&cachedir, "cache", "", "directory for pre-scaled frames (empty disables the disk cache)")
+	flag.StringVar(&setscale, "scale", "stretch", "scaling mode: stretch, fit, fill, center or integer")
+	flag.StringVar(&setgravity, "gravity", "center", "placement for fit, fill and center: center, n, s, e, w, ne, nw, se, sw")
+	flag.StringVar(&setfilter, "filter", "approxbilinear", "interpolation: nearest, approxbilinear, bilinear or catmullrom")
+	flag.StringVar(&setbg, "bg", "000000", "background color for letterboxing (rrggbb)")
+	flag.StringVar(&setfifo, "fifo", "", "named pipe for text, color, image and clear commands, e.g. /run/ledmatrix.fifo")
+	flag.BoolVar(&setstdin, "stdin", false, "read overlay commands from stdin")
+	flag.DurationVar(&setovertime, "overlay-timeout", 0, "hide overlay messages after this time, 0 keeps them")
+	flag.StringVar(&settrans, "transition", "crossfade", "transition when the animation starts over: none, crossfade, wipe-left, wipe-right, wipe-up, wipe-down, dissolve, life, zoom or random")
+	flag.DurationVar(&settranstime, "transition-time", 500*time.Millisecond, "duration of the transition")
+	flag.StringVar(&setstatus, "statusbar", "", "show the time in a bar at the top or bottom, optionally with a layout like bottom:15:04:05")
 
-	flag.Parse()
-
-	config.Rows = *rows
-	config.ChainLength = *chain
-	config.Parallel = *parallel
-	config.PWMBits = 6
-	config.PWMLSBNanoseconds = 95
-	config.Brightness = *brightness
-	config.ScanMode = rgbmatrix.Interlaced
-	config.DisableHardwarePulsing = false
+	fatal(config.Parse("gif"))
+	reloader = config.Watch()
 
-	m, err := rgbmatrix.NewRGBLedMatrix(config)
+	var err error
+	panels, err = panel.NewPanels(hardware, settings)
 	fatal(err)
-	c = rgbmatrix.NewCanvas(m)
-	defer c.Close()
+	goodbye, err := panel.LoadGoodbye(setgoodbye, setgoodbyet)
+	fatal(err)
+	panel.HandleSignals(goodbye, func() { remote.Close() })
+	monitor = health.New(setstale)
+	panels.Monitor = monitor
+	monitor.Gauge("ledmatrix_brightness_percent", "Brightness after dimming.", func() float64 { return float64(panels.Dimmer.Level()) })
+	if sethealth != "" {
+		monitor.Serve(sethealth)
+	}
+	monitor.Watchdog()
+	frames = framecache.New(setwidth, setheight, cachedir)
+	frames.Policy, err = scale.ParsePolicy(setscale, setgravity, setfilter, setbg)
+	fatal(err)
+	effect, err = transition.Parse(settrans)
+	fatal(err)
+	messages = overlay.New(text.Face7x13, setovertime)
+	if setfifo != "" {
+		fatal(messages.ListenFIFO(setfifo))
+	}
+	if setstdin {
+		go messages.Listen(os.Stdin)
+	}
+	layers = compositor.New()
+	layers.Add(compositor.NewLayer("messages", 20, messages))
+	status, err := compositor.ParseStatusBar(setstatus, text.Face7x13)
+	fatal(err)
+	if status != nil {
+		layers.Add(compositor.NewLayer("status", 10, status))
+	}
 
 	field = newField(setwidth, setheight)
 
-	for i := 0; i != setduration; i++ {
-		field.printField(setfilename)
-		fmt.Println("Reset Matrix")
+	if broker.Broker != "" {
+		remote = mqtt.Connect(*broker, mqtt.Handlers{
+			Level:   func(level int) { panels.Dimmer.Override(level, 0) },
+			Release: func() { panels.Dimmer.ClearOverride() },
+			Scene:   reloader.SetScene,
+			Scenes:  reloader.Scenes,
+			Current: reloader.Scene,
+			Text:    func(s string) error { return messages.Exec("text " + s) },
+			Image:   func(path string) error { return messages.Exec("image " + path) },
+		})
+	}
+
+	// a broken file is retried with a growing pause, it may be replaced
+	panel.Supervise("gif", func() error {
+		var err error
+		if out, err = panels.Open(); err != nil {
+			return err
+		}
+		defer out.Close()
+		out.Overlay = layers
+		out.Background = frames.Policy.Background
+
+		for i := 0; i != setduration; i++ {
+			if err := field.printField(setfilename); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
 
-		c.Clear()
-		c.Close()
+// reload applies changed settings between two frames. The panels are
+// only opened again for new hardware settings, everything else changes
+// in place. Broken settings are logged and the old ones stay in effect.
+func reload() {
+	changed := reloader.Reload()
+	if changed == nil {
+		return
+	}
+	panels.Reload(changed)
+	if changed.Scenes {
+		remote.Announce()
+	}
 
-		m, _ = rgbmatrix.NewRGBLedMatrix(config)
-		c = rgbmatrix.NewCanvas(m)
+	if changed.Has("scale", "gravity", "filter", "bg") {
+		if policy, err := scale.ParsePolicy(setscale, setgravity, setfilter, setbg); err != nil {
+			log.Printf("reload: %v", err)
+		} else {
+			frames.Policy = policy
+			out.Background = policy.Background
+		}
+	}
+	if changed.Has("transition") {
+		if e, err := transition.Parse(settrans); err != nil {
+			log.Printf("reload: %v", err)
+		} else {
+			effect = e
+		}
+	}
+	if changed.Has("overlay-timeout") {
+		messages.SetTimeout(setovertime)
+	}
+	if changed.Has("statusbar") {
+		if status, err := compositor.ParseStatusBar(setstatus, text.Face7x13); err != nil {
+			log.Printf("reload: %v", err)
+		} else {
+			layers.Remove("status")
+			if status != nil {
+				layers.Add(compositor.NewLayer("status", 10, status))
+			}
+		}
 	}
 }
@@ -2,23 +2,29 @@ package main
 
 import (
 	"flag"
-	"image/color"
-	"image/png"
+	"image"
 	"log"
 	"math/rand"
 	"os"
-	"simonwaldherr.de/go/golibs/gcurses"
-	rgbmatrix "simonwaldherr.de/go/rpirgbled"
 	"time"
-)
 
-var (
-	rows       = flag.Int("led-rows", 32, "number of rows supported")
-	parallel   = flag.Int("led-parallel", 1, "number of daisy-chained panels")
-	chain      = flag.Int("led-chain", 16, "number of displays daisy-chained")
-	brightness = flag.Int("brightness", 99, "brightness (0-100)")
+	"github.com/SimonWaldherr/RGB-LED-Matrix/config"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/dmx"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/framecache"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/health"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/mqtt"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/panel"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/scale"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/slideshow"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/transition"
+	"simonwaldherr.de/go/golibs/gcurses"
 )
 
+var hardware = config.MatrixFlags(flag.CommandLine)
+var settings = panel.Flags(flag.CommandLine)
+var broker = mqtt.Flags(flag.CommandLine, "image")
+var lighting = dmx.Flags(flag.CommandLine)
+
 type Field struct {
 	cells  [][]int
 	width  int
@@ -36,11 +42,24 @@ var (
 	setfilename  string
 	outputfile   string
 	port         string
+	setgoodbye   string
+	setgoodbyet  time.Duration
+	sethealth    string
+	setstale     time.Duration
+	cachedir     string
+	setscale     string
+	setgravity   string
+	setfilter    string
+	setbg        string
+	setdisplay   time.Duration
+	setplaylist  string
+	settrans     string
+	settranstime time.Duration
 )
 
 func fatal(err error) {
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
 	}
 }
 
@@ -52,106 +71,162 @@ func newField(width, height int) *Field {
 	return &Field{cells: cells, width: width, height: height}
 }
 
-var config = &rgbmatrix.DefaultConfig
-var c *rgbmatrix.Canvas
+var out *panel.Output
+var panels *panel.Panels
+var monitor *health.Monitor
+var frames *framecache.Cache
+var effect transition.Effect
 
-func randomUint() uint8 {
-	return uint8(rand.Intn(255))
-}
+// lastFrame is the frame shown last, the next image blends in from it.
+var lastFrame *image.RGBA
+var reloader *config.Reloader
+var remote *mqtt.Client
 
-func smallRandomUint() uint8 {
-	return uint8(rand.Intn(16))
-}
+// receiver takes over from the images while a lighting console sends.
+var receiver *dmx.Receiver
 
-func newXY(x, y int) (int, int) {
-	var xh, yh int
-	y1 := y
-	x1 := x
-	if y < 64 {
-		yh = y
-		if x < 32 {
-			xh = x
-			x1 = 192 + yh
-			y1 = 31 - xh
-		} else if x < 64 {
-			xh = x - 32
-			x1 = 191 - yh
-			y1 = xh
-		} else if x < 96 {
-			xh = x - 64
-			x1 = 64 + yh
-			y1 = 31 - xh
-		} else if x < 128 {
-			xh = x - 96
-			x1 = 63 - yh
-			y1 = xh
-		} else if x < 192 {
-			x1 = 0
-			y1 = 0
-		}
-	} else if y < 128 {
-		yh = y - 64
-		if x < 32 {
-			xh = x
-			x1 = 256 + yh
-			y1 = 31 - xh
-		} else if x < 64 {
-			xh = x - 32
-			x1 = 383 - yh
-			y1 = xh
-		} else if x < 96 {
-			xh = x - 64
-			x1 = 384 + yh
-			y1 = 31 - xh
-		} else if x < 128 {
-			xh = x - 96
-			x1 = 511 - yh
-			y1 = xh
-		} else if x < 192 {
-			x1 = 0
-			y1 = 0
+// playlist and slides are where the images come from: a playlist, the
+// images of a directory, or neither for the single file -o.
+var playlist *slideshow.Playlist
+var slides *slideshow.Slideshow
+
+// openImages sets up playlist or slides from the flags, replacing the
+// ones in use.
+func openImages() error {
+	var list *slideshow.Playlist
+	var dir *slideshow.Slideshow
+	if setplaylist != "" {
+		var err error
+		list, err = slideshow.ParsePlaylist(setplaylist)
+		if err != nil {
+			return err
 		}
+		log.Printf("playlist with %d entries", len(list.Items))
 	} else {
-		x1 = 0
-		y1 = 0
+		finfo, err := os.Stat(setfilename)
+		if err != nil {
+			return err
+		}
+		if finfo.IsDir() {
+			dir, err = slideshow.New(setfilename)
+			if err != nil {
+				return err
+			}
+			if err := dir.Watch(); err != nil {
+				log.Printf("not watching %s: %v", setfilename, err)
+			}
+			log.Printf("slideshow with %d images from %s", dir.Len(), setfilename)
+		}
 	}
-	return x1, y1
+	if slides != nil {
+		slides.Close()
+	}
+	playlist, slides = list, dir
+	return nil
 }
 
-func resizeImage(src image.Image, newWidth, newHeight int) image.Image {
-	dst := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
-	draw.NearestNeighbor.Scale(dst, dst.Rect, src, src.Bounds(), draw.Over, nil)
-	return dst
+// next returns the next image and how long to show it. ok is false if
+// there is none right now.
+func next() (filename string, display time.Duration, ok bool) {
+	switch {
+	case playlist != nil:
+		item, ok := playlist.Next()
+		if item.Time > 0 {
+			return item.Path, item.Time, ok
+		}
+		return item.Path, setdisplay, ok
+	case slides != nil:
+		filename, ok := slides.Next()
+		return filename, setdisplay, ok
+	}
+	return setfilename, setdisplay, true
 }
 
-func (field *Field) printField() string {
-	file, err := os.Open("./png.png")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer file.Close()
+func randomUint() uint8 {
+	return uint8(rand.Intn(255))
+}
 
-	img, err := png.Decode(file)
-	
-	resizedImg := resizeImage(img, 128, 128)
-	
+func smallRandomUint() uint8 {
+	return uint8(rand.Intn(16))
+}
+
+// printField shows filename for display. Animations are looped until
+// the time is up, but always played at least once. Files that can't be
+// decoded are skipped, only errors of the panels are returned.
+func (field *Field) printField(filename string, display time.Duration) error {
+	anim, err := frames.Load(filename)
 	if err != nil {
-		log.Fatal(os.Stderr, "%s: %v\n", "./png.png", err)
+		log.Printf("skipping %v", err)
+		time.Sleep(time.Second)
+		return nil
 	}
 
-	for y := 0; y < 128; y++ {
-		for x := 0; x < 128; x++ {
+	deadline := time.Now().Add(display)
+	for {
+		for _, frame := range anim.Frames {
+			start := time.Now()
 
-			x1, y1 := newXY(x, y)
+			if lastFrame != nil && lastFrame != frame.Image {
+				err = transition.Play(effect, lastFrame, frame.Image, settranstime, setfps, show)
+				lastFrame = nil
+			} else {
+				err = show(frame.Image)
+			}
+			if err != nil {
+				return err
+			}
+			if receiver.Active() {
+				lastFrame = frame.Image
+				return nil
+			}
 
-			oldPixel := resizedImg.At(x, y)
-			r, g, b, _ := oldPixel.RGBA()
-			c.Set(x1, y1, color.RGBA{uint8(r), uint8(g), uint8(b), 255})
+			if anim.Still() {
+				lastFrame = frame.Image
+				// rendered again every second, for messages and the health
+				// check
+				for wait := time.Until(deadline); wait > 0 && !receiver.Active(); wait = time.Until(deadline) {
+					time.Sleep(min(wait, time.Second))
+					if err := show(frame.Image); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			if elapsed := time.Since(start); frame.Delay > elapsed {
+				time.Sleep(frame.Delay - elapsed)
+			}
+		}
+		if time.Now().After(deadline) {
+			lastFrame = anim.Frames[len(anim.Frames)-1].Image
+			return nil
 		}
 	}
-	c.Render()
-	time.Sleep(time.Minute * 15)
-	return ""
+}
+
+// live shows what the lighting console sends until it stops, the next
+// image then blends in from its last frame.
+func live() error {
+	log.Printf("dmx: receiving, showing the lighting console")
+	frame := image.NewRGBA(image.Rect(0, 0, dmx.Size, dmx.Size))
+	tick := time.NewTicker(time.Second / time.Duration(max(1, setfps)))
+	defer tick.Stop()
+	for receiver.Active() {
+		receiver.Frame(frame)
+		if err := show(frame); err != nil {
+			return err
+		}
+		<-tick.C
+	}
+	log.Printf("dmx: no packets, back to the images")
+	lastFrame = frame
+	return nil
+}
+
+// show renders one frame to the panels.
+func show(frame *image.RGBA) error {
+	reload()
+	out.Draw(frame)
+	return out.Render()
 }
 
 func main() {
@@ -162,25 +237,142 @@ func main() {
 	flag.IntVar(&setheight, "h", 20, "terminal height")
 	flag.IntVar(&setduration, "d", -1, "game of life duration")
 	flag.IntVar(&setfps, "f", 20, "frames per second")
-	flag.StringVar(&setfilename, "o", "", "open file")
+	flag.StringVar(&setfilename, "o", "./png.png", "open file or directory (slideshow)")
+	flag.DurationVar(&setdisplay, "t", 15*time.Second, "display time per image")
+	flag.StringVar(&setplaylist, "playlist", "", "files and directories to show in order instead of -o, comma separated, each optionally with a display time like intro.gif=30s")
+	flag.StringVar(&settrans, "transition", "crossfade", "transition between images: none, crossfade, wipe-left, wipe-right, wipe-up, wipe-down, dissolve, life, zoom or random")
+	flag.DurationVar(&settranstime, "transition-time", time.Second, "duration of the transition")
+	flag.StringVar(&cachedir, "cache", "", "directory for pre-scaled frames (empty disables the disk cache)")
+	flag.StringVar(&setscale, "scale", "stretch", "scaling mode: stretch, fit, fill, center or integer")
+	flag.StringVar(&setgravity, "gravity", "center", "placement for fit, fill and center: center, n, s, e, w, ne, nw, se, sw")
+	flag.StringVar(&setfilter, "filter", "nearest", "interpolation: nearest, approxbilinear, bilinear or catmullrom")
+	flag.StringVar(&setbg, "bg", "000000", "background color for letterboxing (rrggbb)")
 
 	flag.IntVar(&outputlength, "l", 200, "frames")
+	flag.StringVar(&setgoodbye, "goodbye", "", "image shown when stopped with SIGINT or SIGTERM, empty for black")
+	flag.DurationVar(&setgoodbyet, "goodbye-time", 2*time.Second, "how long the goodbye image is shown")
+	flag.StringVar(&sethealth, "health", "", "address for the /healthz and /metrics endpoints, e.g. localhost:9100")
+	flag.DurationVar(&setstale, "health-stale", 30*time.Second, "time without a rendered frame after which the program counts as hung")
+
+	fatal(config.Parse("image"))
 
-	flag.Parse()
+	reloader = config.Watch()
 
-	config.Rows = *rows
-	config.Parallel = *parallel
-	config.ChainLength = *chain
-	config.Brightness = *brightness
+	fatal(openImages())
+	defer func() {
+		if slides != nil {
+			slides.Close()
+		}
+	}()
 
-	m, err := rgbmatrix.NewRGBLedMatrix(config)
+	var err error
+	panels, err = panel.NewPanels(hardware, settings)
+	fatal(err)
+	goodbye, err := panel.LoadGoodbye(setgoodbye, setgoodbyet)
 	fatal(err)
+	panel.HandleSignals(goodbye, func() { remote.Close() })
+	monitor = health.New(setstale)
+	panels.Monitor = monitor
+	monitor.Gauge("ledmatrix_brightness_percent", "Brightness after dimming.", func() float64 { return float64(panels.Dimmer.Level()) })
+	if sethealth != "" {
+		monitor.Serve(sethealth)
+	}
+	monitor.Watchdog()
+
+	frames = framecache.New(128, 128, cachedir)
+	frames.Policy, err = scale.ParsePolicy(setscale, setgravity, setfilter, setbg)
+	fatal(err)
+	effect, err = transition.Parse(settrans)
+	fatal(err)
+
+	if broker.Broker != "" {
+		remote = mqtt.Connect(*broker, mqtt.Handlers{
+			Level:   func(level int) { panels.Dimmer.Override(level, 0) },
+			Release: func() { panels.Dimmer.ClearOverride() },
+			Scene:   reloader.SetScene,
+			Scenes:  reloader.Scenes,
+			Current: reloader.Scene,
+		})
+	}
+
+	if lighting.Protocols != "" {
+		receiver, err = dmx.Listen(*lighting)
+		fatal(err)
+	}
+	defer func() { receiver.Close() }()
+
+	panel.Supervise("image", func() error {
+		var err error
+		if out, err = panels.Open(); err != nil {
+			return err
+		}
+		defer out.Close()
+		out.Background = frames.Policy.Background
+
+		for i := 0; i != setduration; i++ {
+			time.Sleep(time.Millisecond * 25)
+			if receiver.Active() {
+				if err := live(); err != nil {
+					return err
+				}
+				continue
+			}
+			filename, display, ok := next()
+			if !ok {
+				time.Sleep(time.Second)
+				continue
+			}
+			if err := field.printField(filename, display); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
 
-	c = rgbmatrix.NewCanvas(m)
-	defer c.Close()
+// reload applies changed settings between two frames. The panels are
+// only opened again for new hardware settings, everything else changes
+// in place. Broken settings are logged and the old ones stay in effect.
+func reload() {
+	changed := reloader.Reload()
+	if changed == nil {
+		return
+	}
+	panels.Reload(changed)
+	if changed.Scenes {
+		remote.Announce()
+	}
 
-	for i := 0; i != setduration; i++ {
-		time.Sleep(time.Millisecond * 25)
-		field.printField()
+	if changed.Files("o", "playlist") {
+		if err := openImages(); err != nil {
+			log.Printf("reload: %v", err)
+		}
+	}
+	if changed.Has("scale", "gravity", "filter", "bg") {
+		if policy, err := scale.ParsePolicy(setscale, setgravity, setfilter, setbg); err != nil {
+			log.Printf("reload: %v", err)
+		} else {
+			frames.Policy = policy
+			out.Background = policy.Background
+		}
+	}
+	if changed.Has("transition") {
+		if e, err := transition.Parse(settrans); err != nil {
+			log.Printf("reload: %v", err)
+		} else {
+			effect = e
+		}
+	}
+	if changed.Has("dmx-protocols", "dmx-address", "dmx-multicast", "dmx-universe", "dmx-start", "dmx-channels", "dmx-order", "dmx-colors", "dmx-timeout") {
+		// the ports are released before they are bound again
+		receiver.Close()
+		receiver = nil
+		if lighting.Protocols != "" {
+			r, err := dmx.Listen(*lighting)
+			if err != nil {
+				log.Printf("reload: %v", err)
+			}
+			receiver = r
+		}
 	}
 }
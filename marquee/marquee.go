@@ -0,0 +1,293 @@
+// Package marquee renders scrolling messages with colored segments and
+// inline icons.
+//
+// Messages use a small markup: {#rrggbb} switches the color, {#} goes
+// back to the default color, {name} inserts the icon name.png from the
+// icon directory and {{ is a literal brace. Lines are separated by a
+// newline or a literal \n.
+package marquee
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	_ "image/png"
+
+	"golang.org/x/image/font"
+
+	"github.com/SimonWaldherr/RGB-LED-Matrix/scale"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/text"
+)
+
+// Segment is a run of text in one color, or an icon.
+type Segment struct {
+	Text  string
+	Color color.RGBA
+	Icon  string
+}
+
+// Message is a parsed message.
+type Message struct {
+	Raw   string
+	Lines [][]Segment
+	// Once messages are removed from the queue after they were shown.
+	Once bool
+}
+
+// Parse parses the markup of s, with fg as the default color.
+func Parse(s string, fg color.RGBA) Message {
+	m := Message{Raw: s}
+	s = strings.ReplaceAll(s, `\n`, "\n")
+	for _, line := range strings.Split(s, "\n") {
+		var segs []Segment
+		col := fg
+		var cur strings.Builder
+		flush := func() {
+			if cur.Len() > 0 {
+				segs = append(segs, Segment{Text: cur.String(), Color: col})
+				cur.Reset()
+			}
+		}
+		for len(line) > 0 {
+			i := strings.IndexByte(line, '{')
+			if i < 0 {
+				cur.WriteString(line)
+				break
+			}
+			cur.WriteString(line[:i])
+			line = line[i:]
+			if strings.HasPrefix(line, "{{") {
+				cur.WriteByte('{')
+				line = line[2:]
+				continue
+			}
+			end := strings.IndexByte(line, '}')
+			if end < 0 {
+				cur.WriteString(line)
+				break
+			}
+			tag := line[1:end]
+			line = line[end+1:]
+			switch {
+			case tag == "#":
+				flush()
+				col = fg
+			case strings.HasPrefix(tag, "#"):
+				c, err := scale.ParseColor(tag[1:])
+				if err != nil {
+					cur.WriteString("{" + tag + "}")
+					continue
+				}
+				flush()
+				col = c
+			case tag != "":
+				flush()
+				segs = append(segs, Segment{Icon: tag})
+			default:
+				cur.WriteString("{}")
+			}
+		}
+		flush()
+		m.Lines = append(m.Lines, segs)
+	}
+	return m
+}
+
+// Icons loads PNG icons from a directory, scaled to the line height.
+// Characters missing from the font, like emoji, are looked up by their
+// code point in hex, e.g. 1f600.png, as named by Twemoji and Noto.
+type Icons struct {
+	Dir    string
+	Height int
+
+	mu     sync.Mutex
+	cache  map[string]image.Image
+	missed map[string]time.Time
+}
+
+// iconRetry is how long a missing icon is not looked for again, so one
+// added later shows up without a restart.
+const iconRetry = 10 * time.Second
+
+// Get returns the icon name, or nil if there is none.
+func (i *Icons) Get(name string) image.Image {
+	if i == nil || i.Dir == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return nil
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if img, ok := i.cache[name]; ok {
+		return img
+	}
+	if at, ok := i.missed[name]; ok && time.Since(at) < iconRetry {
+		return nil
+	}
+	if i.cache == nil {
+		i.cache = make(map[string]image.Image)
+		i.missed = make(map[string]time.Time)
+	}
+	img, err := i.load(filepath.Join(i.Dir, name+".png"))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("icon %s: %v", name, err)
+		}
+		i.missed[name] = time.Now()
+		return nil
+	}
+	delete(i.missed, name)
+	i.cache[name] = img
+	return img
+}
+
+func (i *Icons) load(filename string) (image.Image, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	b := src.Bounds()
+	if i.Height <= 0 || b.Dy() == i.Height {
+		return src, nil
+	}
+	w := max(1, b.Dx()*i.Height/b.Dy())
+	return scale.Policy{Filter: scale.CatmullRom}.Scale(src, w, i.Height), nil
+}
+
+// piece is a laid out part of a line, text or an icon.
+type piece struct {
+	text  string
+	color color.RGBA
+	icon  image.Image
+	width int
+}
+
+// layout splits a line into pieces, replacing characters the font lacks
+// with icons where there is one.
+func layout(line []Segment, face font.Face, icons *Icons) []piece {
+	var pieces []piece
+	add := func(s string, col color.RGBA) {
+		if s != "" {
+			pieces = append(pieces, piece{text: s, color: col, width: text.Measure(face, s)})
+		}
+	}
+	for _, seg := range line {
+		if seg.Icon != "" {
+			if img := icons.Get(seg.Icon); img != nil {
+				pieces = append(pieces, piece{icon: img, width: img.Bounds().Dx() + 1})
+			}
+			continue
+		}
+		start := 0
+		for i, r := range seg.Text {
+			if _, ok := face.GlyphAdvance(r); ok {
+				continue
+			}
+			img := icons.Get(fmt.Sprintf("%x", r))
+			if img == nil {
+				continue
+			}
+			add(seg.Text[start:i], seg.Color)
+			pieces = append(pieces, piece{icon: img, width: img.Bounds().Dx() + 1})
+			start = i + len(string(r))
+		}
+		add(seg.Text[start:], seg.Color)
+	}
+	return pieces
+}
+
+// Render draws m into a strip as wide as its longest line, with the
+// lines stacked and aligned to each other. The background is
+// transparent.
+func Render(m Message, face font.Face, icons *Icons, align text.Align) *image.RGBA {
+	metrics := face.Metrics()
+	lineHeight, ascent := metrics.Height.Ceil(), metrics.Ascent.Ceil()
+
+	lines := make([][]piece, len(m.Lines))
+	widths := make([]int, len(m.Lines))
+	width := 1
+	for i, line := range m.Lines {
+		lines[i] = layout(line, face, icons)
+		for _, p := range lines[i] {
+			widths[i] += p.width
+		}
+		width = max(width, widths[i])
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, max(1, len(lines)*lineHeight)))
+	for i, line := range lines {
+		x, y := 0, i*lineHeight
+		switch align {
+		case text.Center:
+			x = (width - widths[i]) / 2
+		case text.Right:
+			x = width - widths[i]
+		}
+		for _, p := range line {
+			if p.icon != nil {
+				b := p.icon.Bounds()
+				top := y + (lineHeight-b.Dy())/2
+				draw.Draw(img, image.Rect(x, top, x+b.Dx(), top+b.Dy()), p.icon, b.Min, draw.Over)
+			} else {
+				text.Draw(img, face, x, y+ascent, p.text, p.color, text.Left)
+			}
+			x += p.width
+		}
+	}
+	return img
+}
+
+// Direction is the direction messages scroll in.
+type Direction int
+
+const (
+	Left Direction = iota
+	Right
+	Up
+	Down
+)
+
+var directionNames = []string{"left", "right", "up", "down"}
+
+func (d Direction) String() string {
+	return directionNames[d]
+}
+
+// ParseDirection parses left, right, up or down.
+func ParseDirection(s string) (Direction, error) {
+	for i, name := range directionNames {
+		if strings.EqualFold(s, name) {
+			return Direction(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown direction %q, use left, right, up or down", s)
+}
+
+// Position returns where the strip of size is drawn in a w x h view
+// after scrolling for t at speed pixels per second. It enters from
+// one side, leaves on the other and is centered across the direction.
+// ok is false once it has left the view.
+func Position(d Direction, size image.Point, w, h int, t time.Duration, speed float64) (p image.Point, ok bool) {
+	moved := int(t.Seconds() * speed)
+	switch d {
+	case Left:
+		return image.Pt(w-moved, (h-size.Y)/2), moved < w+size.X
+	case Right:
+		return image.Pt(moved-size.X, (h-size.Y)/2), moved < w+size.X
+	case Up:
+		return image.Pt((w-size.X)/2, h-moved), moved < h+size.Y
+	default:
+		return image.Pt((w-size.X)/2, moved-size.Y), moved < h+size.Y
+	}
+}
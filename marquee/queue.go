@@ -0,0 +1,196 @@
+package marquee
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Queue holds the messages and loops over them.
+type Queue struct {
+	// Max is the number of messages kept, older ones are dropped. 0
+	// keeps all.
+	Max int
+
+	mu       sync.Mutex
+	messages []Message
+	next     int
+}
+
+// Add appends m. Once messages are shown next, before the loop goes on.
+func (q *Queue) Add(m Message) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if m.Once {
+		i := q.next % max(1, len(q.messages))
+		q.messages = append(q.messages[:i], append([]Message{m}, q.messages[i:]...)...)
+		q.next = i
+		return
+	}
+	q.messages = append(q.messages, m)
+	if q.Max > 0 && len(q.messages) > q.Max {
+		drop := len(q.messages) - q.Max
+		q.messages = q.messages[drop:]
+		q.next = max(0, q.next-drop)
+	}
+}
+
+// Set replaces all messages.
+func (q *Queue) Set(messages []Message) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.messages = append([]Message(nil), messages...)
+	q.next = 0
+}
+
+// Clear removes all messages.
+func (q *Queue) Clear() {
+	q.Set(nil)
+}
+
+// List returns the messages in queue order.
+func (q *Queue) List() []Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]Message(nil), q.messages...)
+}
+
+// Next returns the next message, wrapping around at the end. ok is
+// false while the queue is empty.
+func (q *Queue) Next() (m Message, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.messages) == 0 {
+		return Message{}, false
+	}
+	q.next %= len(q.messages)
+	m = q.messages[q.next]
+	if m.Once {
+		q.messages = append(q.messages[:q.next], q.messages[q.next+1:]...)
+	} else {
+		q.next++
+	}
+	return m, true
+}
+
+// ReadLines adds every non-empty line read from r until it ends, like a
+// pipe on stdin.
+func ReadLines(r io.Reader, q *Queue, parse func(string) Message) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" {
+			q.Add(parse(line))
+		}
+	}
+	return s.Err()
+}
+
+// LoadFile reads a message file, one message per line. Empty lines and
+// lines starting with # are skipped.
+func LoadFile(filename string, parse func(string) Message) ([]Message, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var messages []Message
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		messages = append(messages, parse(line))
+	}
+	return messages, nil
+}
+
+// WatchFile loads filename into q and reloads it whenever it changes,
+// checking every interval.
+func WatchFile(filename string, interval time.Duration, q *Queue, parse func(string) Message) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	messages, err := LoadFile(filename, parse)
+	if err != nil {
+		return err
+	}
+	q.Set(messages)
+
+	go func() {
+		modified := info.ModTime()
+		for range time.Tick(interval) {
+			info, err := os.Stat(filename)
+			if err != nil || info.ModTime().Equal(modified) {
+				continue
+			}
+			modified = info.ModTime()
+			messages, err := LoadFile(filename, parse)
+			if err != nil {
+				log.Printf("reloading %s: %v", filename, err)
+				continue
+			}
+			q.Set(messages)
+			log.Printf("reloaded %d messages from %s", len(messages), filename)
+		}
+	}()
+	return nil
+}
+
+// Handler serves the queue over HTTP:
+//
+//	GET    lists the messages, one per line
+//	POST   adds the body as one message, ?once shows it next and once
+//	PUT    replaces all messages, one per line
+//	DELETE removes all messages
+func Handler(q *Queue, parse func(string) Message) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			for _, m := range q.List() {
+				fmt.Fprintln(w, strings.ReplaceAll(m.Raw, "\n", `\n`))
+			}
+			return
+		case http.MethodDelete:
+			q.Clear()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case http.MethodPost, http.MethodPut:
+		default:
+			http.Error(w, "use GET, POST, PUT or DELETE", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		msg := strings.TrimSpace(string(body))
+		if r.Method == http.MethodPut {
+			var messages []Message
+			for _, line := range strings.Split(msg, "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					messages = append(messages, parse(line))
+				}
+			}
+			q.Set(messages)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if msg == "" {
+			http.Error(w, "empty message", http.StatusBadRequest)
+			return
+		}
+		m := parse(msg)
+		_, m.Once = r.URL.Query()["once"]
+		q.Add(m)
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
@@ -0,0 +1,75 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// entity is the discovery config of one Home Assistant entity.
+type entity map[string]any
+
+// announce publishes the discovery configs, so Home Assistant shows the
+// wall as a device with a light and the scene, text and image fields.
+func (c *Client) announce() {
+	id := c.id()
+	device := map[string]any{
+		"identifiers":  []string{id},
+		"name":         c.Name,
+		"manufacturer": "SimonWaldherr",
+		"model":        "RGB-LED-Matrix",
+	}
+	common := func(object, name string) entity {
+		return entity{
+			"name":               name,
+			"unique_id":          id + "_" + object,
+			"availability_topic": c.topic("availability"),
+			"device":             device,
+		}
+	}
+
+	if c.Level != nil && c.Release != nil {
+		e := common("light", "Display")
+		e["command_topic"] = c.topic("power", "set")
+		e["state_topic"] = c.topic("power")
+		e["brightness_command_topic"] = c.topic("brightness", "set")
+		e["brightness_state_topic"] = c.topic("brightness")
+		e["brightness_scale"] = 100
+		e["payload_on"], e["payload_off"] = "ON", "OFF"
+		c.discover("light", "light", e)
+	}
+	if c.Scene != nil && c.Scenes != nil {
+		if scenes := c.Scenes(); len(scenes) > 0 {
+			e := common("scene", "Scene")
+			e["command_topic"] = c.topic("scene", "set")
+			e["state_topic"] = c.topic("scene")
+			e["options"] = scenes
+			c.discover("select", "scene", e)
+		}
+	}
+	if c.Text != nil {
+		e := common("text", "Text")
+		e["command_topic"] = c.topic("text", "set")
+		e["state_topic"] = c.topic("text")
+		e["max"] = 255
+		c.discover("text", "text", e)
+	}
+	if c.Image != nil {
+		e := common("image", "Image")
+		e["command_topic"] = c.topic("image", "set")
+		e["state_topic"] = c.topic("image")
+		e["max"] = 255
+		c.discover("text", "image", e)
+	}
+}
+
+// discover publishes the config of an entity of component, like light,
+// retained so Home Assistant finds it after a restart.
+func (c *Client) discover(component, object string, e entity) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("mqtt: discovery: %v", err)
+		return
+	}
+	topic := c.Discovery + "/" + component + "/" + c.id() + "/" + object + "/config"
+	c.client.Publish(topic, 1, true, data)
+}
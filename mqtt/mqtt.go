@@ -0,0 +1,289 @@
+// Package mqtt puts the wall on an MQTT broker for home automation. It
+// subscribes to command topics below a prefix, like ledmatrix/clock,
+//
+//	<topic>/power/set        ON or OFF
+//	<topic>/brightness/set   brightness in percent, 0-100
+//	<topic>/scene/set        name of a scene from the config file
+//	<topic>/text/set         message shown over the picture
+//	<topic>/image/set        path or http(s) URL of an image shown over it
+//
+// and publishes the state to the same topics without /set, all of it as
+// JSON to <topic>/state, and online or offline to <topic>/availability.
+// Home Assistant finds the wall by MQTT discovery as a light with
+// selects and text fields for scene, message and image.
+package mqtt
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Config holds the connection settings.
+type Config struct {
+	// Broker is the URL of the broker, like tcp://localhost:1883, empty
+	// disables MQTT.
+	Broker   string
+	Topic    string
+	User     string
+	Password string
+	// Discovery is the discovery prefix of Home Assistant, empty
+	// disables discovery.
+	Discovery string
+	// Name is the name of the device in Home Assistant.
+	Name string
+}
+
+// Flags adds the MQTT flags of the program app to fs.
+func Flags(fs *flag.FlagSet, app string) *Config {
+	c := &Config{}
+	fs.StringVar(&c.Broker, "mqtt-broker", "", "MQTT broker for remote control, e.g. tcp://localhost:1883")
+	fs.StringVar(&c.Topic, "mqtt-topic", "ledmatrix/"+app, "prefix of the MQTT topics")
+	fs.StringVar(&c.User, "mqtt-user", "", "MQTT user name")
+	fs.StringVar(&c.Password, "mqtt-password", "", "MQTT password")
+	fs.StringVar(&c.Discovery, "mqtt-discovery", "homeassistant", "Home Assistant discovery prefix, empty disables discovery")
+	fs.StringVar(&c.Name, "mqtt-name", "LED-Matrix "+app, "device name in Home Assistant")
+	return c
+}
+
+// Handlers carry out the commands. Commands without a handler are
+// neither subscribed to nor announced to Home Assistant. They are called
+// one after the other, in the order the commands arrive, from a goroutine
+// of the MQTT client.
+type Handlers struct {
+	// Level fixes the brightness in percent of the hardware brightness,
+	// Release returns to the schedule or sensor.
+	Level   func(percent int)
+	Release func()
+	// Scene switches to a scene, Scenes lists them and Current returns
+	// the scene in use, empty for none.
+	Scene   func(name string) error
+	Scenes  func() []string
+	Current func() string
+	Text    func(s string) error
+	Image   func(path string) error
+}
+
+// State is what the client publishes.
+type State struct {
+	State      string `json:"state"`
+	Brightness int    `json:"brightness"`
+	Scene      string `json:"scene,omitempty"`
+	Text       string `json:"text,omitempty"`
+	Image      string `json:"image,omitempty"`
+}
+
+// Client is a connection to the broker.
+type Client struct {
+	Config
+	Handlers
+
+	client paho.Client
+
+	mu         sync.Mutex
+	state      State
+	overridden bool
+}
+
+// Connect connects to the broker in the background, retrying until it
+// is reachable and reconnecting when the connection drops.
+func Connect(config Config, handlers Handlers) *Client {
+	c := &Client{
+		Config:   config,
+		Handlers: handlers,
+		state:    State{State: "ON", Brightness: 100},
+	}
+	host, _ := os.Hostname()
+	opts := paho.NewClientOptions().
+		AddBroker(config.Broker).
+		SetClientID(c.id()+"-"+host).
+		SetUsername(config.User).
+		SetPassword(config.Password).
+		SetWill(c.topic("availability"), "offline", 1, true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(10 * time.Second).
+		SetOnConnectHandler(c.connected).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			log.Printf("mqtt: connection lost: %v", err)
+		})
+	c.client = paho.NewClient(opts)
+	c.client.Connect()
+	log.Printf("mqtt: connecting to %s as %s", config.Broker, config.Topic)
+	return c
+}
+
+// Close says goodbye to the broker.
+func (c *Client) Close() {
+	if c == nil {
+		return
+	}
+	c.publish("availability", "offline")
+	c.client.Disconnect(250)
+}
+
+// Announce sends the discovery configs and the state again, after a
+// reload changed the scenes.
+func (c *Client) Announce() {
+	if c == nil || !c.client.IsConnectionOpen() {
+		return
+	}
+	if c.Discovery != "" {
+		c.announce()
+	}
+	c.publishState()
+}
+
+// connected subscribes and announces the wall, after every reconnect.
+func (c *Client) connected(client paho.Client) {
+	log.Printf("mqtt: connected to %s", c.Broker)
+	commands := map[string]func(string) error{}
+	if c.Level != nil && c.Release != nil {
+		commands["power"] = c.power
+		commands["brightness"] = c.brightness
+	}
+	if c.Scene != nil {
+		commands["scene"] = c.scene
+	}
+	if c.Text != nil {
+		commands["text"] = c.text
+	}
+	if c.Image != nil {
+		commands["image"] = c.image
+	}
+	for name, run := range commands {
+		name, run := name, run
+		client.Subscribe(c.topic(name, "set"), 1, func(_ paho.Client, msg paho.Message) {
+			payload := strings.TrimSpace(string(msg.Payload()))
+			if err := run(payload); err != nil {
+				log.Printf("mqtt: %s %q: %v", name, payload, err)
+				return
+			}
+			c.publishState()
+		})
+	}
+	if c.Discovery != "" {
+		c.announce()
+	}
+	c.publish("availability", "online")
+	c.publishState()
+}
+
+func (c *Client) power(payload string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch strings.ToUpper(payload) {
+	case "ON":
+		c.state.State = "ON"
+		if c.overridden {
+			c.Level(c.state.Brightness)
+		} else {
+			c.Release()
+		}
+	case "OFF":
+		c.state.State = "OFF"
+		c.Level(0)
+	default:
+		return fmt.Errorf("want ON or OFF")
+	}
+	return nil
+}
+
+func (c *Client) brightness(payload string) error {
+	level, err := strconv.Atoi(payload)
+	if err != nil || level < 0 || level > 100 {
+		return fmt.Errorf("want a percentage")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state.Brightness, c.overridden = level, true
+	if c.state.State == "ON" {
+		c.Level(level)
+	}
+	return nil
+}
+
+func (c *Client) scene(payload string) error {
+	if err := c.Scene(payload); err != nil {
+		return err
+	}
+	if c.Current == nil {
+		c.mu.Lock()
+		c.state.Scene = payload
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+func (c *Client) text(payload string) error {
+	if err := c.Text(payload); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.state.Text = payload
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Client) image(payload string) error {
+	if err := c.Image(payload); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.state.Image = payload
+	c.mu.Unlock()
+	return nil
+}
+
+// publishState publishes the state, as JSON and topic by topic.
+func (c *Client) publishState() {
+	c.mu.Lock()
+	state := c.state
+	c.mu.Unlock()
+	if c.Current != nil {
+		state.Scene = c.Current()
+	}
+
+	data, _ := json.Marshal(state)
+	c.publish("state", string(data))
+	if c.Level != nil {
+		c.publish("power", state.State)
+		c.publish("brightness", strconv.Itoa(state.Brightness))
+	}
+	if c.Scene != nil && state.Scene != "" {
+		c.publish("scene", state.Scene)
+	}
+	if c.Text != nil {
+		c.publish("text", state.Text)
+	}
+	if c.Image != nil {
+		c.publish("image", state.Image)
+	}
+}
+
+// publish publishes a retained message below the topic prefix.
+func (c *Client) publish(topic, payload string) {
+	c.client.Publish(c.topic(topic), 1, true, payload)
+}
+
+func (c *Client) topic(parts ...string) string {
+	return strings.Join(append([]string{strings.TrimSuffix(c.Topic, "/")}, parts...), "/")
+}
+
+// id turns the topic prefix into an identifier for Home Assistant.
+func (c *Client) id() string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, strings.Trim(c.Topic, "/"))
+}
@@ -0,0 +1,255 @@
+// Package overlay shows text and images from scripts on top of whatever
+// the wall is showing. It reads line commands from stdin or a named
+// pipe:
+//
+//	text <message>   show a message, with the markup of the marquee package
+//	color <rrggbb>   color of the following messages
+//	image <path>     show an image or the image at an http(s) URL, fitted
+//	                 into the wall
+//	timeout <d>      hide what is shown after d, like 30s, 0 keeps it
+//	clear            hide the overlay
+//
+// Any other line is shown as a message, so
+//
+//	echo "Build green" > /run/ledmatrix.fifo
+//
+// just works.
+package overlay
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"golang.org/x/image/font"
+
+	"github.com/SimonWaldherr/RGB-LED-Matrix/marquee"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/panel"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/scale"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/text"
+)
+
+// Overlay holds what the commands show. It implements panel.Overlay.
+type Overlay struct {
+	Face  font.Face
+	Icons *marquee.Icons
+	// Speed in pixels per second of messages wider than the wall.
+	Speed float64
+	// Band is drawn behind messages to keep them readable.
+	Band color.RGBA
+	// Slide is how long new messages take to slide in from the bottom.
+	Slide time.Duration
+
+	mu      sync.Mutex
+	color   color.RGBA
+	timeout time.Duration
+	message *image.RGBA
+	picture *image.RGBA
+	shown   time.Time
+}
+
+// New returns an overlay that hides messages after timeout, 0 keeps
+// them until cleared.
+func New(face font.Face, timeout time.Duration) *Overlay {
+	return &Overlay{
+		Face:    face,
+		Speed:   32,
+		Band:    color.RGBA{0, 0, 0, 192},
+		Slide:   300 * time.Millisecond,
+		color:   color.RGBA{255, 255, 255, 255},
+		timeout: timeout,
+	}
+}
+
+// SetFace changes the font of the messages shown from now on.
+func (o *Overlay) SetFace(face font.Face) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.Face = face
+}
+
+// SetTimeout changes the time after which messages are hidden, 0 keeps
+// them until cleared.
+func (o *Overlay) SetTimeout(timeout time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.timeout = timeout
+}
+
+// Exec runs one command line.
+func (o *Overlay) Exec(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil
+	}
+	cmd, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+
+	// load before locking, downloads take a while
+	var img *image.RGBA
+	if strings.EqualFold(cmd, "image") {
+		var err error
+		if img, err = loadImage(arg); err != nil {
+			return err
+		}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	switch strings.ToLower(cmd) {
+	case "text":
+		o.show(arg)
+	case "color":
+		c, err := scale.ParseColor(arg)
+		if err != nil {
+			return err
+		}
+		o.color = c
+	case "image":
+		o.message, o.picture, o.shown = nil, img, time.Now()
+	case "timeout":
+		d, err := time.ParseDuration(arg)
+		if err != nil {
+			return err
+		}
+		o.timeout = d
+	case "clear":
+		o.message, o.picture = nil, nil
+	default:
+		o.show(line)
+	}
+	return nil
+}
+
+func (o *Overlay) show(s string) {
+	o.message, o.picture, o.shown = nil, nil, time.Now()
+	if s != "" {
+		o.message = marquee.Render(marquee.Parse(s, o.color), o.Face, o.Icons, text.Center)
+	}
+}
+
+// MaxDownload limits the size of images loaded from a URL.
+const MaxDownload = 10 << 20
+
+func loadImage(filename string) (*image.RGBA, error) {
+	var r io.ReadCloser
+	if strings.HasPrefix(filename, "http://") || strings.HasPrefix(filename, "https://") {
+		client := http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Get(filename)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%s: %s", filename, resp.Status)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		r = f
+	}
+	defer r.Close()
+	img, _, err := image.Decode(io.LimitReader(r, MaxDownload))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return scale.Policy{Mode: scale.Fit, Filter: scale.CatmullRom}.Scale(img, panel.Width, panel.Height), nil
+}
+
+// Draw draws the overlay onto frame.
+func (o *Overlay) Draw(frame *image.RGBA) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.timeout > 0 && time.Since(o.shown) > o.timeout {
+		o.message, o.picture = nil, nil
+	}
+
+	if o.picture != nil {
+		draw.Draw(frame, frame.Rect, o.picture, image.Point{}, draw.Over)
+	}
+	if o.message == nil {
+		return
+	}
+
+	// centered, or scrolling through in a loop if it is too wide
+	w, h := frame.Rect.Dx(), frame.Rect.Dy()
+	size := o.message.Rect.Size()
+	p := image.Pt((w-size.X)/2, (h-size.Y)/2)
+	if size.X > w {
+		loop := time.Duration(float64(w+size.X) / o.Speed * float64(time.Second))
+		p, _ = marquee.Position(marquee.Left, size, w, h, time.Since(o.shown)%loop, o.Speed)
+	}
+	if since := time.Since(o.shown); since < o.Slide {
+		p.Y += int(float64(h-p.Y+2) * (1 - float64(since)/float64(o.Slide)))
+	}
+	band := image.Rect(0, p.Y-2, w, p.Y+size.Y+2)
+	draw.Draw(frame, band, image.NewUniform(o.Band), image.Point{}, draw.Over)
+	draw.Draw(frame, o.message.Rect.Add(p), o.message, image.Point{}, draw.Over)
+}
+
+// maxLine is the longest command Listen accepts.
+const maxLine = 64 << 10
+
+// Listen runs the commands read from r until it ends. Lines longer than
+// maxLine are skipped.
+func (o *Overlay) Listen(r io.Reader) error {
+	br := bufio.NewReaderSize(r, maxLine)
+	for {
+		line, long, err := br.ReadLine()
+		if long {
+			for long && err == nil {
+				_, long, err = br.ReadLine()
+			}
+			log.Printf("overlay: line longer than %d bytes skipped", maxLine)
+			continue
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := o.Exec(string(line)); err != nil {
+			log.Printf("overlay: %v", err)
+		}
+	}
+}
+
+// ListenFIFO creates the named pipe path if needed and runs the commands
+// written to it in the background.
+func (o *Overlay) ListenFIFO(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := syscall.Mkfifo(path, 0o620); err != nil {
+			return fmt.Errorf("creating %s: %v", path, err)
+		}
+	}
+	// opened for writing too, so the pipe doesn't end with every writer
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer f.Close()
+		if err := o.Listen(f); err != nil {
+			log.Printf("overlay %s: %v", path, err)
+		}
+	}()
+	return nil
+}
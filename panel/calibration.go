@@ -0,0 +1,134 @@
+package panel
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"math"
+	"os"
+	"strings"
+)
+
+// Calibration corrects the colors for the panels. A calibration file
+// is JSON like
+//
+//	{
+//	  "gamma": 2.2,
+//	  "white_balance": [1.0, 0.9, 0.75],
+//	  "panels": [
+//	    {"panel": 5, "matrix": [[1, 0, 0], [0, 0.95, 0], [0.02, 0, 0.9]]}
+//	  ]
+//	}
+//
+// Gamma maps the sRGB input to PWM levels, the white balance scales the
+// red, green and blue output, and the optional 3x3 matrix of a panel
+// mixes the linear channels for panels from a different batch.
+type Calibration struct {
+	Gamma        float64       `json:"gamma"`
+	WhiteBalance [3]float64    `json:"white_balance"`
+	Panels       []PanelMatrix `json:"panels"`
+
+	identity bool
+	lut      [3][256]uint8
+	linear   [256]float64
+	matrix   [Count]*[3][3]float64
+}
+
+// PanelMatrix is the color correction matrix of a single panel.
+type PanelMatrix struct {
+	Panel  int           `json:"panel"`
+	Matrix [3][3]float64 `json:"matrix"`
+}
+
+// NewCalibration returns a calibration that leaves colors unchanged.
+func NewCalibration() *Calibration {
+	cal := &Calibration{}
+	cal.prepare()
+	return cal
+}
+
+// LoadCalibration reads a calibration file. An empty filename returns
+// the identity calibration, and a filename starting with { is taken as
+// the JSON itself, which is how a config file passes it on.
+func LoadCalibration(filename string) (*Calibration, error) {
+	if filename == "" {
+		return NewCalibration(), nil
+	}
+	var data []byte
+	if strings.HasPrefix(strings.TrimSpace(filename), "{") {
+		data, filename = []byte(filename), "calibration"
+	} else {
+		var err error
+		data, err = os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cal := &Calibration{}
+	if err := json.Unmarshal(data, cal); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if cal.Gamma < 0 {
+		return nil, fmt.Errorf("%s: negative gamma %v", filename, cal.Gamma)
+	}
+	for _, p := range cal.Panels {
+		if p.Panel < 0 || p.Panel >= Count {
+			return nil, fmt.Errorf("%s: panel %d out of range 0-%d", filename, p.Panel, Count-1)
+		}
+	}
+	cal.prepare()
+	return cal, nil
+}
+
+// prepare fills in defaults and builds the lookup tables.
+func (cal *Calibration) prepare() {
+	if cal.Gamma == 0 {
+		cal.Gamma = 1
+	}
+	if cal.WhiteBalance == [3]float64{} {
+		cal.WhiteBalance = [3]float64{1, 1, 1}
+	}
+
+	for v := 0; v < 256; v++ {
+		cal.linear[v] = math.Pow(float64(v)/255, cal.Gamma)
+		for ch := 0; ch < 3; ch++ {
+			cal.lut[ch][v] = clamp(cal.linear[v] * cal.WhiteBalance[ch])
+		}
+	}
+
+	cal.matrix = [Count]*[3][3]float64{}
+	for i := range cal.Panels {
+		cal.matrix[cal.Panels[i].Panel] = &cal.Panels[i].Matrix
+	}
+
+	cal.identity = cal.Gamma == 1 && cal.WhiteBalance == [3]float64{1, 1, 1} && len(cal.Panels) == 0
+}
+
+// Apply returns the corrected color of a pixel on the given panel.
+func (cal *Calibration) Apply(panel int, c color.RGBA) color.RGBA {
+	if cal.identity {
+		return c
+	}
+	m := cal.matrix[panel]
+	if m == nil {
+		return color.RGBA{cal.lut[0][c.R], cal.lut[1][c.G], cal.lut[2][c.B], c.A}
+	}
+
+	in := [3]float64{cal.linear[c.R], cal.linear[c.G], cal.linear[c.B]}
+	var out [3]uint8
+	for ch := 0; ch < 3; ch++ {
+		v := m[ch][0]*in[0] + m[ch][1]*in[1] + m[ch][2]*in[2]
+		out[ch] = clamp(v * cal.WhiteBalance[ch])
+	}
+	return color.RGBA{out[0], out[1], out[2], c.A}
+}
+
+func clamp(v float64) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 1:
+		return 255
+	}
+	return uint8(v*255 + 0.5)
+}
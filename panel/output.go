@@ -0,0 +1,246 @@
+package panel
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+	"time"
+
+	rgbmatrix "simonwaldherr.de/go/rpirgbled"
+)
+
+// Dimmer returns the brightness in percent of the hardware brightness.
+type Dimmer interface {
+	Level() int
+}
+
+// Overlay draws on top of every frame before it is rendered, like
+// messages over the clock.
+type Overlay interface {
+	Draw(frame *image.RGBA)
+}
+
+// Monitor is told about every frame Render writes, like health.Monitor.
+// current is the estimated current in amps, err the error of the
+// canvas.
+type Monitor interface {
+	Frame(took time.Duration, current float64, err error)
+}
+
+// ErrClosed is returned by Render once the output is closed.
+var ErrClosed = errors.New("panel: output closed")
+
+// errNoCanvas is returned by Render after Reopen failed. Unlike
+// ErrClosed it makes Supervise restart the render loop, which opens the
+// panels again.
+var errNoCanvas = errors.New("panel: the panels could not be opened again")
+
+// Output collects a logical frame and writes it to the canvas on
+// Render, composited over Background, mapped to the panel layout,
+// calibrated, dimmed and kept within the power budget. Like the canvas,
+// the frame is empty again after every Render.
+type Output struct {
+	Canvas      *rgbmatrix.Canvas
+	Calibration *Calibration
+	Background  color.RGBA
+	Dimmer      Dimmer
+	Overlay     Overlay
+	Power       *PowerBudget
+	Monitor     Monitor
+
+	// Rotate turns the picture clockwise by 0, 90, 180 or 270 degrees,
+	// for a wall that is mounted the other way round.
+	Rotate int
+
+	// Current is the estimated current of the last frame in amps,
+	// after limiting.
+	Current float64
+
+	mu     sync.Mutex
+	closed bool
+	frame  *image.RGBA
+	pixels []color.RGBA
+}
+
+// NewOutput returns an output for canvas. A nil calibration leaves the
+// colors unchanged.
+func NewOutput(canvas *rgbmatrix.Canvas, cal *Calibration) *Output {
+	if cal == nil {
+		cal = NewCalibration()
+	}
+	o := &Output{
+		Canvas:      canvas,
+		Calibration: cal,
+		frame:       image.NewRGBA(image.Rect(0, 0, Width, Height)),
+		pixels:      make([]color.RGBA, Width*Height),
+	}
+	register(o)
+	return o
+}
+
+// Set sets the logical pixel x, y. c is alpha-premultiplied like every
+// color.RGBA.
+func (o *Output) Set(x, y int, c color.RGBA) {
+	o.frame.SetRGBA(x, y, c)
+}
+
+// Draw draws img over the frame, aligning its top left corner with the
+// top left of the panels. Any image type works, translucent pixels are
+// blended over what is already in the frame.
+func (o *Output) Draw(img image.Image) {
+	draw.Draw(o.frame, o.frame.Rect, img, img.Bounds().Min, draw.Over)
+}
+
+// Frame returns the frame buffer for drawing into it directly. Like Set
+// and Draw, only the render loop may use it; a shutdown doesn't touch it.
+func (o *Output) Frame() *image.RGBA {
+	return o.frame
+}
+
+// Render writes the frame to the panels and clears it.
+func (o *Output) Render() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return ErrClosed
+	}
+	if o.Canvas == nil {
+		return errNoCanvas
+	}
+	if o.Monitor == nil {
+		return o.render(o.frame)
+	}
+	start := time.Now()
+	err := o.render(o.frame)
+	o.Monitor.Frame(time.Since(start), o.Current, err)
+	return err
+}
+
+// render writes frame to the panels and clears it. o.mu has to be held.
+func (o *Output) render(frame *image.RGBA) error {
+	if o.Overlay != nil {
+		o.Overlay.Draw(frame)
+	}
+
+	level := 100
+	if o.Dimmer != nil {
+		level = max(0, min(100, o.Dimmer.Level()))
+	}
+	dim := uint32(level * 256 / 100)
+
+	for y := 0; y < Height; y++ {
+		for x := 0; x < Width; x++ {
+			c := Over(frame.RGBAAt(x, y), o.Background)
+			px, py := o.rotate(x, y)
+			c = o.Calibration.Apply(Index(px, py), c)
+			if level < 100 {
+				// dim after calibration, where the levels are linear
+				c.R = uint8(uint32(c.R) * dim >> 8)
+				c.G = uint8(uint32(c.G) * dim >> 8)
+				c.B = uint8(uint32(c.B) * dim >> 8)
+			}
+			o.pixels[py*Width+px] = c
+		}
+	}
+
+	var factors [Count]uint32
+	for i := range factors {
+		factors[i] = 256
+	}
+	if o.Power != nil {
+		amps := o.Power.Estimate(o.pixels)
+		o.Current = 0
+		for i, f := range o.Power.Factors(amps) {
+			factors[i] = uint32(f * 256)
+			o.Current += o.Power.IdleAmps + (amps[i]-o.Power.IdleAmps)*float64(factors[i])/256
+		}
+	}
+
+	for y := 0; y < Height; y++ {
+		for x := 0; x < Width; x++ {
+			c := o.pixels[y*Width+x]
+			if f := factors[Index(x, y)]; f < 256 {
+				c.R = uint8(uint32(c.R) * f >> 8)
+				c.G = uint8(uint32(c.G) * f >> 8)
+				c.B = uint8(uint32(c.B) * f >> 8)
+			}
+			x1, y1 := XY(x, y)
+			o.Canvas.Set(x1, y1, c)
+		}
+	}
+	clear(frame.Pix)
+	return o.Canvas.Render()
+}
+
+// Reopen closes the canvas, which releases the GPIO, and continues on
+// the canvas open returns, for changed hardware settings. Everything
+// else about the output is kept. If open fails, Render returns an error
+// until the output is closed, so the render loop is restarted.
+func (o *Output) Reopen(open func() (*rgbmatrix.Canvas, error)) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return ErrClosed
+	}
+	if o.Canvas != nil {
+		if err := o.Canvas.Close(); err != nil {
+			return err
+		}
+	}
+	canvas, err := open()
+	o.Canvas = canvas
+	return err
+}
+
+// rotate returns where the logical pixel x, y ends up on the panels.
+func (o *Output) rotate(x, y int) (int, int) {
+	switch o.Rotate {
+	case 90:
+		return Width - 1 - y, x
+	case 180:
+		return Width - 1 - x, Height - 1 - y
+	case 270:
+		return y, Height - 1 - x
+	}
+	return x, y
+}
+
+// Close waits for the frame being rendered, blanks the panels and closes
+// the canvas, which releases the GPIO. Later calls to Render return
+// ErrClosed.
+func (o *Output) Close() error {
+	return o.close(nil, 0)
+}
+
+// close shows img for hold before closing, nil shows black. It runs on
+// the signal goroutine while the render loop may still draw, so the
+// goodbye frame has a buffer of its own.
+func (o *Output) close(img image.Image, hold time.Duration) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return nil
+	}
+	o.closed = true
+	unregister(o)
+	if o.Canvas == nil {
+		return nil
+	}
+
+	if img != nil {
+		frame := image.NewRGBA(o.frame.Rect)
+		draw.Draw(frame, frame.Rect, img, img.Bounds().Min, draw.Over)
+		// the goodbye frame alone, without messages on top
+		o.Overlay = nil
+		if err := o.render(frame); err != nil {
+			return err
+		}
+		time.Sleep(hold)
+	}
+	if err := o.Canvas.Clear(); err != nil {
+		return err
+	}
+	return o.Canvas.Close()
+}
@@ -0,0 +1,53 @@
+// Package panel maps the logical 128x128 picture onto the eight chained
+// 64x32 panels of the wall and applies the color calibration on the way
+// out.
+package panel
+
+const (
+	// Width and Height of the logical picture.
+	Width  = 128
+	Height = 128
+
+	// Count is the number of physical panels. Every panel covers 32
+	// logical columns and 64 logical rows.
+	Count = 8
+)
+
+// XY returns the canvas position of the logical pixel x, y.
+func XY(x, y int) (int, int) {
+	switch {
+	case y < 64:
+		switch {
+		case x < 32:
+			return 192 + y, 31 - x
+		case x < 64:
+			return 191 - y, x - 32
+		case x < 96:
+			return 64 + y, 31 - (x - 64)
+		case x < 128:
+			return 63 - y, x - 96
+		}
+	case y < 128:
+		yh := y - 64
+		switch {
+		case x < 32:
+			return 256 + yh, 31 - x
+		case x < 64:
+			return 383 - yh, x - 32
+		case x < 96:
+			return 384 + yh, 31 - (x - 64)
+		case x < 128:
+			return 511 - yh, x - 96
+		}
+	}
+	return 0, 0
+}
+
+// Index returns the number of the panel showing the logical pixel x, y,
+// counted row by row from the top left, 0 to Count-1.
+func Index(x, y int) int {
+	if x < 0 || y < 0 || x >= Width || y >= Height {
+		return 0
+	}
+	return y/64*4 + x/32
+}
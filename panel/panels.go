@@ -0,0 +1,154 @@
+package panel
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"github.com/SimonWaldherr/RGB-LED-Matrix/config"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/dimming"
+	rgbmatrix "simonwaldherr.de/go/rpirgbled"
+)
+
+// Settings are the calibration, dimming and power settings every
+// program shares.
+type Settings struct {
+	Calibration string
+	Schedule    string
+	Sensor      string
+	SensorRange string
+	Ramp        time.Duration
+	Power       float64
+	PanelPower  string
+	PanelAmps   float64
+}
+
+// Flags adds the calibration, dimming and power flags to fs.
+func Flags(fs *flag.FlagSet) *Settings {
+	s := &Settings{}
+	fs.StringVar(&s.Calibration, "calibration", "", "color calibration file (JSON)")
+	fs.StringVar(&s.Schedule, "brightness-schedule", "", "brightness in percent by time of day, e.g. 08:00=100,22:00=30")
+	fs.StringVar(&s.Sensor, "brightness-sensor", "", "file with light sensor readings, e.g. a sysfs illuminance file")
+	fs.StringVar(&s.SensorRange, "brightness-sensor-range", "0:1000", "sensor readings for the darkest and brightest level")
+	fs.DurationVar(&s.Ramp, "brightness-ramp", 5*time.Second, "time to ramp brightness from 0 to 100 percent")
+	fs.Float64Var(&s.Power, "power-budget", 0, "maximum current of all panels in amps, 0 disables the limit")
+	fs.StringVar(&s.PanelPower, "power-panel-budget", "", "maximum current per panel in amps, one value or one per panel")
+	fs.Float64Var(&s.PanelAmps, "power-panel-amps", 4, "current of one panel showing full white in amps")
+	return s
+}
+
+// Panels opens the panels with the hardware settings and the shared
+// settings, and applies changed settings to them on reload, the same way
+// in every program.
+type Panels struct {
+	Hardware *config.Matrix
+	Settings *Settings
+	Monitor  Monitor
+
+	// Config is what the panels are opened with. It only changes when
+	// opening them with new hardware settings worked.
+	Config      *rgbmatrix.HardwareConfig
+	Calibration *Calibration
+	// Dimmer is reconfigured in place and never replaced, so other
+	// goroutines may use it.
+	Dimmer *dimming.Controller
+	Power  *PowerBudget
+
+	out *Output
+}
+
+// NewPanels checks the settings and starts the dimmer. The panels are
+// opened by Open.
+func NewPanels(hardware *config.Matrix, settings *Settings) (*Panels, error) {
+	p := &Panels{Hardware: hardware, Settings: settings}
+	var err error
+	if p.Config, err = hardware.HardwareConfig(); err != nil {
+		return nil, err
+	}
+	if p.Calibration, err = LoadCalibration(settings.Calibration); err != nil {
+		return nil, err
+	}
+	if p.Dimmer, err = dimming.New(settings.Schedule, settings.Sensor, settings.SensorRange, settings.Ramp); err != nil {
+		return nil, err
+	}
+	p.Power = NewPowerBudget(settings.Power, settings.PanelAmps, p.Config.Brightness)
+	if p.Power.Panels, err = ParsePanelBudgets(settings.PanelPower); err != nil {
+		return nil, err
+	}
+	p.Dimmer.Start()
+	return p, nil
+}
+
+// Open opens the panels and returns an output for them. The render loop
+// calls it every time it is started, so a restart by Supervise begins
+// with freshly opened panels.
+func (p *Panels) Open() (*Output, error) {
+	m, err := rgbmatrix.NewRGBLedMatrix(p.Config)
+	if err != nil {
+		return nil, err
+	}
+	out := NewOutput(rgbmatrix.NewCanvas(m), p.Calibration)
+	out.Dimmer = p.Dimmer
+	out.Power = p.Power
+	out.Monitor = p.Monitor
+	out.Rotate = p.Hardware.Rotate
+	p.out = out
+	return out, nil
+}
+
+// Reload applies changed settings to the output of the last Open. The
+// panels are only opened again for new hardware settings, and if that
+// fails they are opened with the previous ones. Broken settings are
+// logged and the old ones stay in effect.
+func (p *Panels) Reload(changed *config.Changes) {
+	if reopen, err := p.Hardware.Reopen(p.Config); err != nil {
+		log.Printf("reload: %v", err)
+	} else if reopen && p.out != nil {
+		next, _ := p.Hardware.HardwareConfig()
+		log.Printf("reload: hardware settings changed, opening the panels again")
+		err := p.out.Reopen(func() (*rgbmatrix.Canvas, error) {
+			m, err := rgbmatrix.NewRGBLedMatrix(next)
+			if err == nil {
+				p.Config = next
+				return rgbmatrix.NewCanvas(m), nil
+			}
+			log.Printf("reload: %v, opening the panels with the previous settings", err)
+			if m, err = rgbmatrix.NewRGBLedMatrix(p.Config); err != nil {
+				return nil, err
+			}
+			return rgbmatrix.NewCanvas(m), nil
+		})
+		if err != nil {
+			log.Printf("reload: %v", err)
+		}
+		p.Power.Brightness = p.Config.Brightness
+	}
+	p.Dimmer.SetLimit(p.Hardware.Limit(p.Config))
+
+	if changed.Files("calibration") {
+		if cal, err := LoadCalibration(p.Settings.Calibration); err != nil {
+			log.Printf("reload: %v", err)
+		} else {
+			p.Calibration = cal
+		}
+	}
+	if changed.Has("brightness-schedule", "brightness-sensor", "brightness-sensor-range", "brightness-ramp") {
+		if err := p.Dimmer.Configure(p.Settings.Schedule, p.Settings.Sensor, p.Settings.SensorRange, p.Settings.Ramp); err != nil {
+			log.Printf("reload: %v", err)
+		}
+	}
+	if changed.Has("power-budget", "power-panel-budget", "power-panel-amps") {
+		if budgets, err := ParsePanelBudgets(p.Settings.PanelPower); err != nil {
+			log.Printf("reload: %v", err)
+		} else {
+			p.Power = NewPowerBudget(p.Settings.Power, p.Settings.PanelAmps, p.Config.Brightness)
+			p.Power.Panels = budgets
+		}
+	}
+
+	if p.out != nil {
+		p.out.Rotate = p.Hardware.Rotate
+		p.out.Calibration = p.Calibration
+		p.out.Power = p.Power
+	}
+}
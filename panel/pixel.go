@@ -0,0 +1,37 @@
+package panel
+
+import (
+	"image/color"
+)
+
+// Color converts any color to an opaque 8 bit panel color, composited
+// over bg. RGBA returns alpha-premultiplied 16 bit channels, so the high
+// byte is what the panel gets, not the low one.
+func Color(c color.Color, bg color.RGBA) color.RGBA {
+	if rgba, ok := c.(color.RGBA); ok {
+		return Over(rgba, bg)
+	}
+	r, g, b, a := c.RGBA()
+	ia := 0xffff - a
+	return color.RGBA{
+		R: uint8((r + uint32(bg.R)*ia/0xff) >> 8),
+		G: uint8((g + uint32(bg.G)*ia/0xff) >> 8),
+		B: uint8((b + uint32(bg.B)*ia/0xff) >> 8),
+		A: 255,
+	}
+}
+
+// Over composites the premultiplied color c over bg and returns it
+// opaque.
+func Over(c, bg color.RGBA) color.RGBA {
+	if c.A == 255 {
+		return c
+	}
+	ia := uint32(255 - c.A)
+	return color.RGBA{
+		R: c.R + uint8((uint32(bg.R)*ia+127)/255),
+		G: c.G + uint8((uint32(bg.G)*ia+127)/255),
+		B: c.B + uint8((uint32(bg.B)*ia+127)/255),
+		A: 255,
+	}
+}
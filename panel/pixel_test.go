@@ -0,0 +1,67 @@
+package panel
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestColor(t *testing.T) {
+	black := color.RGBA{0, 0, 0, 255}
+	white := color.RGBA{255, 255, 255, 255}
+	bg := color.RGBA{10, 20, 30, 255}
+
+	paletted := image.NewPaletted(image.Rect(0, 0, 2, 1), color.Palette{
+		color.NRGBA{0, 0, 255, 0},
+		color.NRGBA{255, 0, 0, 128},
+	})
+	paletted.SetColorIndex(1, 0, 1)
+
+	tests := []struct {
+		name string
+		c    color.Color
+		bg   color.RGBA
+		want color.RGBA
+	}{
+		// the high byte of 16 bit channels, not the low one
+		{"gray16 white", color.Gray16{0xffff}, black, color.RGBA{255, 255, 255, 255}},
+		{"gray16 low byte", color.Gray16{0x00ff}, black, color.RGBA{0, 0, 0, 255}},
+		{"rgba64", color.RGBA64{0xffff, 0x00ff, 0x8000, 0xffff}, black, color.RGBA{255, 0, 128, 255}},
+
+		// non-premultiplied sources are premultiplied before compositing
+		{"nrgba opaque", color.NRGBA{200, 100, 50, 255}, bg, color.RGBA{200, 100, 50, 255}},
+		{"nrgba half over black", color.NRGBA{255, 0, 0, 128}, black, color.RGBA{128, 0, 0, 255}},
+		{"nrgba half over white", color.NRGBA{255, 0, 0, 128}, white, color.RGBA{255, 127, 127, 255}},
+		{"nrgba transparent", color.NRGBA{255, 255, 255, 0}, bg, bg},
+		{"nrgba64 half", color.NRGBA64{0xffff, 0xffff, 0xffff, 0x8000}, black, color.RGBA{128, 128, 128, 255}},
+
+		{"paletted transparent", paletted.At(0, 0), bg, bg},
+		{"paletted half", paletted.At(1, 0), black, color.RGBA{128, 0, 0, 255}},
+
+		{"rgba", color.RGBA{100, 50, 0, 255}, bg, color.RGBA{100, 50, 0, 255}},
+	}
+	for _, tt := range tests {
+		if got := Color(tt.c, tt.bg); got != tt.want {
+			t.Errorf("%s: Color(%v, %v) = %v, want %v", tt.name, tt.c, tt.bg, got, tt.want)
+		}
+	}
+}
+
+func TestOver(t *testing.T) {
+	tests := []struct {
+		name  string
+		c, bg color.RGBA
+		want  color.RGBA
+	}{
+		{"opaque", color.RGBA{1, 2, 3, 255}, color.RGBA{200, 200, 200, 255}, color.RGBA{1, 2, 3, 255}},
+		{"transparent", color.RGBA{0, 0, 0, 0}, color.RGBA{10, 20, 30, 255}, color.RGBA{10, 20, 30, 255}},
+		// half transparent red over blue keeps half of the blue
+		{"half", color.RGBA{128, 0, 0, 128}, color.RGBA{0, 0, 200, 255}, color.RGBA{128, 0, 100, 255}},
+		{"half over gray", color.RGBA{64, 64, 64, 128}, color.RGBA{100, 100, 100, 255}, color.RGBA{114, 114, 114, 255}},
+	}
+	for _, tt := range tests {
+		if got := Over(tt.c, tt.bg); got != tt.want {
+			t.Errorf("%s: Over(%v, %v) = %v, want %v", tt.name, tt.c, tt.bg, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package panel
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// pixelsPerPanel is the number of LEDs of a 64x32 panel.
+const pixelsPerPanel = Width * Height / Count
+
+// PowerBudget estimates the current a frame draws from the pixel values
+// and scales the frame down when it would exceed the supply. A budget of
+// 0 disables the limit.
+type PowerBudget struct {
+	// PanelAmps is the current of one panel showing full white at full
+	// brightness, IdleAmps the current of a dark panel.
+	PanelAmps float64
+	IdleAmps  float64
+	// Brightness is the hardware brightness in percent.
+	Brightness int
+
+	// Total limits all panels together, Panels limits every panel on
+	// its own, for separately fused supply rails.
+	Total  float64
+	Panels [Count]float64
+}
+
+// NewPowerBudget returns a budget of total amps for panels drawing
+// panelAmps at full white.
+func NewPowerBudget(total, panelAmps float64, brightness int) *PowerBudget {
+	return &PowerBudget{
+		PanelAmps:  panelAmps,
+		IdleAmps:   0.05,
+		Brightness: brightness,
+		Total:      total,
+	}
+}
+
+// ParsePanelBudgets parses the per-panel budgets in amps, either a
+// single value for every panel or a comma-separated list of Count values.
+func ParsePanelBudgets(s string) ([Count]float64, error) {
+	var budgets [Count]float64
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return budgets, nil
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) != 1 && len(parts) != Count {
+		return budgets, fmt.Errorf("panel budgets %q: want 1 or %d values", s, Count)
+	}
+	for i := range budgets {
+		v, err := strconv.ParseFloat(strings.TrimSpace(parts[i%len(parts)]), 64)
+		if err != nil || v < 0 {
+			return budgets, fmt.Errorf("panel budgets %q: invalid value %q", s, parts[i%len(parts)])
+		}
+		budgets[i] = v
+	}
+	return budgets, nil
+}
+
+// Estimate returns the current of every panel in amps for a frame of
+// Width x Height colors in row order.
+func (b *PowerBudget) Estimate(pixels []color.RGBA) [Count]float64 {
+	var sums [Count]uint64
+	for y := 0; y < Height; y++ {
+		for x := 0; x < Width; x++ {
+			c := pixels[y*Width+x]
+			sums[Index(x, y)] += uint64(c.R) + uint64(c.G) + uint64(c.B)
+		}
+	}
+
+	// a channel at 255 draws a third of a white pixel
+	perUnit := b.PanelAmps / pixelsPerPanel / 3 / 255 * float64(b.Brightness) / 100
+	var amps [Count]float64
+	for i, sum := range sums {
+		amps[i] = b.IdleAmps + float64(sum)*perUnit
+	}
+	return amps
+}
+
+// Factors returns the scale factor for every panel that keeps the
+// estimated currents within the budgets, 1 where nothing needs to be
+// done.
+func (b *PowerBudget) Factors(amps [Count]float64) [Count]float64 {
+	var factors [Count]float64
+	total := 0.0
+	for i := range factors {
+		factors[i] = 1
+		total += amps[i]
+	}
+
+	idle := b.IdleAmps * Count
+	if b.Total > 0 && total > b.Total && total > idle {
+		f := max(0, (b.Total-idle)/(total-idle))
+		for i := range factors {
+			factors[i] = f
+		}
+	}
+	for i, limit := range b.Panels {
+		if limit > 0 && amps[i] > limit && amps[i] > b.IdleAmps {
+			factors[i] = min(factors[i], max(0, (limit-b.IdleAmps)/(amps[i]-b.IdleAmps)))
+		}
+	}
+	return factors
+}
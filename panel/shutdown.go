@@ -0,0 +1,110 @@
+package panel
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/SimonWaldherr/RGB-LED-Matrix/scale"
+)
+
+// open holds the outputs that aren't closed yet, so a shutdown can blank
+// all of them.
+var open = struct {
+	sync.Mutex
+	outputs map[*Output]bool
+}{outputs: make(map[*Output]bool)}
+
+func register(o *Output) {
+	open.Lock()
+	open.outputs[o] = true
+	open.Unlock()
+}
+
+func unregister(o *Output) {
+	open.Lock()
+	delete(open.outputs, o)
+	open.Unlock()
+}
+
+// Goodbye is what the panels show when the program is stopped, before
+// they go dark.
+type Goodbye struct {
+	// Image is fitted into the panels, nil goes dark right away.
+	Image image.Image
+	Hold  time.Duration
+}
+
+// LoadGoodbye loads the goodbye image from filename, an empty filename
+// blanks the panels.
+func LoadGoodbye(filename string, hold time.Duration) (Goodbye, error) {
+	g := Goodbye{Hold: hold}
+	if filename == "" {
+		return g, nil
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return g, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return g, fmt.Errorf("%s: %v", filename, err)
+	}
+	g.Image = scale.Policy{Mode: scale.Fit, Filter: scale.CatmullRom}.Scale(img, Width, Height)
+	return g, nil
+}
+
+// Shutdown shows g on every open output and closes them.
+func Shutdown(g Goodbye) {
+	open.Lock()
+	outputs := make([]*Output, 0, len(open.outputs))
+	for o := range open.outputs {
+		outputs = append(outputs, o)
+	}
+	open.Unlock()
+
+	var wg sync.WaitGroup
+	for _, o := range outputs {
+		wg.Add(1)
+		go func(o *Output) {
+			defer wg.Done()
+			if err := o.close(g.Image, g.Hold); err != nil {
+				log.Printf("closing panels: %v", err)
+			}
+		}(o)
+	}
+	wg.Wait()
+}
+
+// HandleSignals ends the program on SIGINT and SIGTERM, which is what
+// systemd sends on stop: the render loop is stopped after its current
+// frame, the panels show g and go dark, and the process exits. cleanup
+// runs before the panels are closed.
+func HandleSignals(g Goodbye, cleanup ...func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Printf("%v, shutting down", sig)
+		// a second signal doesn't wait for the goodbye frame
+		go func() {
+			<-signals
+			os.Exit(1)
+		}()
+		for _, f := range cleanup {
+			f()
+		}
+		Shutdown(g)
+		os.Exit(0)
+	}()
+}
@@ -0,0 +1,51 @@
+package panel
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+)
+
+// The pause before restarting a failed render loop doubles from
+// MinBackoff up to MaxBackoff, and starts over once the loop kept
+// running for MaxBackoff.
+var (
+	MinBackoff = time.Second
+	MaxBackoff = time.Minute
+)
+
+// Supervise runs the render loop run until it returns nil or ErrClosed.
+// Errors and panics are logged with name and run is started again after
+// a pause, so a flaky panel or a broken file doesn't take the wall down.
+// run opens the panels itself with Panels.Open, so every start begins
+// with freshly opened panels.
+func Supervise(name string, run func() error) {
+	backoff := MinBackoff
+	for {
+		start := time.Now()
+		err := protect(run)
+		if err == nil || errors.Is(err, ErrClosed) {
+			return
+		}
+		if time.Since(start) >= MaxBackoff {
+			backoff = MinBackoff
+		}
+		log.Printf("%s: %v, restarting in %v", name, err, backoff)
+		time.Sleep(backoff)
+		backoff = min(2*backoff, MaxBackoff)
+	}
+}
+
+// protect turns a panic in run into an error, logging where it
+// happened.
+func protect(run func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("panic: %v\n%s", r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return run()
+}
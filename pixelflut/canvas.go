@@ -0,0 +1,76 @@
+package pixelflut
+
+import (
+	"image"
+	"sync/atomic"
+)
+
+// Canvas is the framebuffer the clients draw into. Pixels are written
+// without a lock, so any number of connections can draw while it is
+// rendered.
+type Canvas struct {
+	width, height int
+	// pix holds 0xrrggbb per pixel
+	pix []atomic.Uint32
+}
+
+// NewCanvas returns a black canvas of width by height pixels.
+func NewCanvas(width, height int) *Canvas {
+	return &Canvas{
+		width:  width,
+		height: height,
+		pix:    make([]atomic.Uint32, width*height),
+	}
+}
+
+// Size returns the width and height.
+func (c *Canvas) Size() (width, height int) {
+	return c.width, c.height
+}
+
+// Set sets the pixel x, y, which has to be on the canvas.
+func (c *Canvas) Set(x, y int, r, g, b uint8) {
+	c.pix[y*c.width+x].Store(uint32(r)<<16 | uint32(g)<<8 | uint32(b))
+}
+
+// Blend blends the color with alpha a over the pixel x, y. Two clients
+// blending the same pixel at once may lose one of the writes.
+func (c *Canvas) Blend(x, y int, r, g, b, a uint8) {
+	if a == 0xff {
+		c.Set(x, y, r, g, b)
+		return
+	}
+	p := &c.pix[y*c.width+x]
+	old := p.Load()
+	mix := func(dst uint32, src uint8) uint32 {
+		return (uint32(src)*uint32(a) + dst*uint32(255-a) + 127) / 255
+	}
+	p.Store(mix(old>>16&0xff, r)<<16 | mix(old>>8&0xff, g)<<8 | mix(old&0xff, b))
+}
+
+// At returns the color of the pixel x, y.
+func (c *Canvas) At(x, y int) (r, g, b uint8) {
+	v := c.pix[y*c.width+x].Load()
+	return uint8(v >> 16), uint8(v >> 8), uint8(v)
+}
+
+// Draw copies the canvas into the top left of dst.
+func (c *Canvas) Draw(dst *image.RGBA) {
+	w := min(c.width, dst.Rect.Dx())
+	h := min(c.height, dst.Rect.Dy())
+	for y := 0; y < h; y++ {
+		o := dst.PixOffset(dst.Rect.Min.X, dst.Rect.Min.Y+y)
+		for x := 0; x < w; x++ {
+			v := c.pix[y*c.width+x].Load()
+			dst.Pix[o], dst.Pix[o+1], dst.Pix[o+2], dst.Pix[o+3] = uint8(v>>16), uint8(v>>8), uint8(v), 0xff
+			o += 4
+		}
+	}
+}
+
+// Clear makes the canvas black.
+func (c *Canvas) Clear() {
+	for i := range c.pix {
+		c.pix[i].Store(0)
+	}
+}
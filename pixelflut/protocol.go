@@ -0,0 +1,197 @@
+package pixelflut
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strconv"
+)
+
+// help is the answer to HELP.
+const help = `PX <x> <y> <rrggbb>  set a pixel, rrggbbaa blends, ww is gray
+PX <x> <y>           get a pixel
+SIZE                 get the size of the canvas
+OFFSET <x> <y>       add x and y to the following coordinates
+HELP                 this text
+`
+
+// helpBinary is added to help with binary commands enabled.
+const helpBinary = `PBxxyyrgba           set a pixel in 10 bytes, x and y 16 bit little endian
+`
+
+// binaryLen is the length of a PB command.
+const binaryLen = 10
+
+// errTooLong ends connections that send a line too long for a command.
+var errTooLong = errors.New("pixelflut: line too long")
+
+// client is the state of one connection.
+type client struct {
+	server *Server
+	r      *bufio.Reader
+	w      *bufio.Writer
+	limit  limiter
+
+	offsetX, offsetY int
+}
+
+// command reads and carries out one command. Every command counts
+// against the rate limit, reads and unknown ones too, so answers can't
+// be requested faster than pixels can be set. Unknown commands and
+// pixels off the canvas are ignored, only read errors are returned.
+func (c *client) command() error {
+	if c.server.Binary {
+		if prefix, err := c.r.Peek(2); err == nil && prefix[0] == 'P' && prefix[1] == 'B' {
+			return c.binary()
+		}
+	}
+	line, err := c.r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return errTooLong
+	}
+	if err != nil {
+		return err
+	}
+	line = bytes.TrimRight(line, "\r\n")
+	c.limit.take()
+
+	cmd, args := field(line)
+	switch string(cmd) {
+	case "PX":
+		c.px(args)
+	case "SIZE":
+		w, h := c.server.Canvas.Size()
+		c.w.WriteString("SIZE " + strconv.Itoa(w) + " " + strconv.Itoa(h) + "\n")
+	case "OFFSET":
+		xs, rest := field(args)
+		ys, _ := field(rest)
+		x, okx := atoi(xs)
+		y, oky := atoi(ys)
+		if okx && oky {
+			c.offsetX, c.offsetY = x, y
+		}
+	case "HELP":
+		c.w.WriteString(help)
+		if c.server.Binary {
+			c.w.WriteString(helpBinary)
+		}
+	}
+	return nil
+}
+
+// px sets or gets a pixel.
+func (c *client) px(args []byte) {
+	xs, rest := field(args)
+	ys, rest := field(rest)
+	hex, _ := field(rest)
+	x, okx := atoi(xs)
+	y, oky := atoi(ys)
+	if !okx || !oky {
+		return
+	}
+	x, y = x+c.offsetX, y+c.offsetY
+	canvas := c.server.Canvas
+	if x < 0 || y < 0 || x >= canvas.width || y >= canvas.height {
+		return
+	}
+
+	if len(hex) == 0 {
+		r, g, b := canvas.At(x, y)
+		buf := c.w.AvailableBuffer()
+		buf = append(buf, "PX "...)
+		buf = strconv.AppendInt(buf, int64(x), 10)
+		buf = append(buf, ' ')
+		buf = strconv.AppendInt(buf, int64(y), 10)
+		buf = append(buf, ' ', digits[r>>4], digits[r&15], digits[g>>4], digits[g&15], digits[b>>4], digits[b&15], '\n')
+		c.w.Write(buf)
+		return
+	}
+
+	if len(hex) != 2 && len(hex) != 6 && len(hex) != 8 {
+		return
+	}
+	var v [4]uint8
+	for i := 0; i < len(hex)/2; i++ {
+		hi, lo := unhex(hex[2*i]), unhex(hex[2*i+1])
+		if hi < 0 || lo < 0 {
+			return
+		}
+		v[i] = uint8(hi<<4 | lo)
+	}
+	switch len(hex) {
+	case 2:
+		canvas.Set(x, y, v[0], v[0], v[0])
+	case 6:
+		canvas.Set(x, y, v[0], v[1], v[2])
+	case 8:
+		canvas.Blend(x, y, v[0], v[1], v[2], v[3])
+	}
+	c.server.pixels.Add(1)
+}
+
+// binary reads and carries out a PB command.
+func (c *client) binary() error {
+	buf, err := c.r.Peek(binaryLen)
+	if err != nil {
+		return err
+	}
+	x := int(buf[2]) + int(buf[3])<<8 + c.offsetX
+	y := int(buf[4]) + int(buf[5])<<8 + c.offsetY
+	r, g, b, a := buf[6], buf[7], buf[8], buf[9]
+	c.r.Discard(binaryLen)
+	c.limit.take()
+
+	canvas := c.server.Canvas
+	if x < 0 || y < 0 || x >= canvas.width || y >= canvas.height {
+		return nil
+	}
+	canvas.Blend(x, y, r, g, b, a)
+	c.server.pixels.Add(1)
+	return nil
+}
+
+const digits = "0123456789abcdef"
+
+// field splits off the first word of s.
+func field(s []byte) (word, rest []byte) {
+	s = bytes.TrimLeft(s, " \t")
+	if i := bytes.IndexAny(s, " \t"); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, nil
+}
+
+// atoi parses a decimal number without allocating.
+func atoi(s []byte) (int, bool) {
+	if len(s) == 0 || len(s) > 9 {
+		return 0, false
+	}
+	sign := 1
+	if s[0] == '-' {
+		sign, s = -1, s[1:]
+		if len(s) == 0 {
+			return 0, false
+		}
+	}
+	n := 0
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return 0, false
+		}
+		n = n*10 + int(ch-'0')
+	}
+	return sign * n, true
+}
+
+// unhex returns the value of a hex digit, -1 for anything else.
+func unhex(ch byte) int {
+	switch {
+	case ch >= '0' && ch <= '9':
+		return int(ch - '0')
+	case ch >= 'a' && ch <= 'f':
+		return int(ch-'a') + 10
+	case ch >= 'A' && ch <= 'F':
+		return int(ch-'A') + 10
+	}
+	return -1
+}
@@ -0,0 +1,145 @@
+package pixelflut
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// run carries out the commands in input on s and returns the answers.
+func run(t *testing.T, s *Server, input string) string {
+	t.Helper()
+	var out bytes.Buffer
+	c := &client{
+		server: s,
+		r:      bufio.NewReader(strings.NewReader(input)),
+		w:      bufio.NewWriter(&out),
+		limit:  limiter{rate: float64(s.Rate)},
+	}
+	for c.command() == nil {
+	}
+	c.w.Flush()
+	return out.String()
+}
+
+func TestAtoi(t *testing.T) {
+	tests := []struct {
+		s  string
+		n  int
+		ok bool
+	}{
+		{"0", 0, true},
+		{"127", 127, true},
+		{"-5", -5, true},
+		{"", 0, false},
+		{"-", 0, false},
+		{"1x", 0, false},
+		{"+1", 0, false},
+		{"123456789", 123456789, true},
+		{"1234567890", 0, false},
+	}
+	for _, tt := range tests {
+		if n, ok := atoi([]byte(tt.s)); n != tt.n || ok != tt.ok {
+			t.Errorf("atoi(%q) = %d, %v, want %d, %v", tt.s, n, ok, tt.n, tt.ok)
+		}
+	}
+}
+
+func TestPX(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"PX 1 2 ff8000", "PX 1 2 ff8000\n"},
+		{"PX 1 2 80", "PX 1 2 808080\n"},
+		{"PX 1 2 FF000080", "PX 1 2 800000\n"},
+		{"PX 1 2\tff8000\r", "PX 1 2 ff8000\n"},
+		// wrong lengths and digits leave the pixel black
+		{"PX 1 2 f", "PX 1 2 000000\n"},
+		{"PX 1 2 fff", "PX 1 2 000000\n"},
+		{"PX 1 2 ff80001", "PX 1 2 000000\n"},
+		{"PX 1 2 ff800g", "PX 1 2 000000\n"},
+		// off the canvas nothing is set or answered
+		{"PX 4 2 ffffff", "PX 1 2 000000\n"},
+	}
+	for _, tt := range tests {
+		s := NewServer(NewCanvas(4, 4))
+		if got := run(t, s, tt.cmd+"\nPX 1 2\n"); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+func TestOffset(t *testing.T) {
+	s := NewServer(NewCanvas(4, 4))
+	got := run(t, s, "OFFSET 2 1\nPX 1 1 ffffff\nPX -2 -1 00ff00\nOFFSET 0 0\nPX 3 2\nPX 0 0\nPX 9 9\n")
+	if want := "PX 3 2 ffffff\nPX 0 0 00ff00\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSizeAndHelp(t *testing.T) {
+	s := NewServer(NewCanvas(128, 64))
+	if got := run(t, s, "SIZE\n"); got != "SIZE 128 64\n" {
+		t.Errorf("SIZE: got %q", got)
+	}
+	if got := run(t, s, "HELP\n"); got != help {
+		t.Errorf("HELP: got %q", got)
+	}
+	s.Binary = true
+	if got := run(t, s, "HELP\n"); got != help+helpBinary {
+		t.Errorf("HELP with binary: got %q", got)
+	}
+}
+
+func TestBinary(t *testing.T) {
+	pb := "PB\x01\x00\x02\x00\xff\x80\x00\xff" + "PB\x03\x00\x00\x01\xff\xff\xff\xff"
+	s := NewServer(NewCanvas(4, 4))
+	s.Binary = true
+	// the second pixel is off the canvas, the line after it is read as usual
+	if got := run(t, s, pb+"PX 1 2\nPX 3 0\n"); got != "PX 1 2 ff8000\nPX 3 0 000000\n" {
+		t.Errorf("got %q", got)
+	}
+
+	// without -binary PB is an unknown line
+	s = NewServer(NewCanvas(4, 4))
+	if got := run(t, s, "PB\x01\x00\x02\x00\xff\x80\x00\xff\nPX 1 2\n"); got != "PX 1 2 000000\n" {
+		t.Errorf("binary off: got %q", got)
+	}
+}
+
+func TestTooLong(t *testing.T) {
+	s := NewServer(NewCanvas(4, 4))
+	c := &client{
+		server: s,
+		r:      bufio.NewReaderSize(strings.NewReader(strings.Repeat("x", 5000)+"\n"), 4096),
+		w:      bufio.NewWriter(&bytes.Buffer{}),
+	}
+	if err := c.command(); err != errTooLong {
+		t.Errorf("got %v, want %v", err, errTooLong)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := limiter{rate: 1000}
+	start := time.Now()
+	// a full bucket, then half a second worth
+	for i := 0; i < 1500; i++ {
+		l.take()
+	}
+	if took := time.Since(start); took < 450*time.Millisecond {
+		t.Errorf("1500 takes at 1000/s took %v, want about 500ms", took)
+	}
+}
+
+func TestReadsAreLimited(t *testing.T) {
+	s := NewServer(NewCanvas(4, 4))
+	s.Rate = 100
+	start := time.Now()
+	run(t, s, strings.Repeat("PX 0 0\n", 100)+strings.Repeat("SIZE\n", 50))
+	if took := time.Since(start); took < 450*time.Millisecond {
+		t.Errorf("150 reads at 100/s took %v, want about 500ms", took)
+	}
+}
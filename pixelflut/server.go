@@ -0,0 +1,216 @@
+// Package pixelflut serves the wall as a Pixelflut target: anyone on the
+// network draws into a shared framebuffer by sending lines over TCP,
+//
+//	PX <x> <y> <rrggbb>     set a pixel, rrggbbaa blends, ww is gray
+//	PX <x> <y>              answers PX <x> <y> <rrggbb>
+//	SIZE                    answers SIZE <width> <height>
+//	OFFSET <x> <y>          adds x and y to the following coordinates
+//	HELP                    lists the commands
+//
+// With binary commands enabled, the ten bytes "PB", x and y as 16 bit
+// little endian and r, g, b, a set a pixel as well.
+package pixelflut
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Server accepts the clients. The settings have to be made before
+// Serve.
+type Server struct {
+	Canvas *Canvas
+	// Rate is the number of commands per second a connection may send,
+	// 0 for no limit. Faster clients are slowed down by reading less.
+	Rate int
+	// MaxConns is the maximum number of connections, MaxPerIP the
+	// maximum per client address, 0 for no limit.
+	MaxConns int
+	MaxPerIP int
+	// Idle is how long a connection may stay silent, 0 forever.
+	Idle time.Duration
+	// Binary enables the PB command.
+	Binary bool
+
+	pixels atomic.Uint64
+
+	mu        sync.Mutex
+	closed    bool
+	listeners []net.Listener
+	conns     map[net.Conn]bool
+	perIP     map[string]int
+}
+
+// NewServer returns a server drawing into canvas.
+func NewServer(canvas *Canvas) *Server {
+	return &Server{
+		Canvas: canvas,
+		conns:  make(map[net.Conn]bool),
+		perIP:  make(map[string]int),
+	}
+}
+
+// Listen listens on the TCP address addr and serves in the background.
+func (s *Server) Listen(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("pixelflut: listening on %v", l.Addr())
+	go s.Serve(l)
+	return nil
+}
+
+// Serve accepts connections on l until the server is closed.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return net.ErrClosed
+	}
+	s.listeners = append(s.listeners, l)
+	s.mu.Unlock()
+
+	var pause time.Duration
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return err
+		}
+		if err != nil {
+			// out of file descriptors, most likely, wait for some to
+			// be closed
+			pause = min(max(2*pause, 5*time.Millisecond), time.Second)
+			log.Printf("pixelflut: %v, retrying in %v", err, pause)
+			time.Sleep(pause)
+			continue
+		}
+		pause = 0
+		if !s.admit(conn) {
+			conn.Close()
+			continue
+		}
+		go s.handle(conn)
+	}
+}
+
+// admit registers conn if it is within the limits.
+func (s *Server) admit(conn net.Conn) bool {
+	ip := host(conn)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.MaxConns > 0 && len(s.conns) >= s.MaxConns || s.MaxPerIP > 0 && s.perIP[ip] >= s.MaxPerIP {
+		return false
+	}
+	s.conns[conn] = true
+	s.perIP[ip]++
+	return true
+}
+
+// release unregisters and closes conn.
+func (s *Server) release(conn net.Conn) {
+	ip := host(conn)
+	s.mu.Lock()
+	delete(s.conns, conn)
+	if s.perIP[ip]--; s.perIP[ip] <= 0 {
+		delete(s.perIP, ip)
+	}
+	s.mu.Unlock()
+	conn.Close()
+}
+
+// host returns the client address of conn without the port.
+func host(conn net.Conn) string {
+	if a, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		return a.IP.String()
+	}
+	return conn.RemoteAddr().String()
+}
+
+// handle serves one client until it hangs up, stays silent for too long
+// or sends a line too long to be a command.
+func (s *Server) handle(conn net.Conn) {
+	defer s.release(conn)
+	c := &client{
+		server: s,
+		r:      bufio.NewReaderSize(conn, 4096),
+		w:      bufio.NewWriterSize(conn, 1024),
+		limit:  limiter{rate: float64(s.Rate)},
+	}
+	for {
+		if c.r.Buffered() == 0 {
+			// answers go out before waiting for more
+			if err := c.w.Flush(); err != nil {
+				return
+			}
+			if s.Idle > 0 {
+				conn.SetReadDeadline(time.Now().Add(s.Idle))
+			}
+		}
+		if err := c.command(); err != nil {
+			return
+		}
+	}
+}
+
+// Connections returns the number of connected clients.
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// Pixels returns the number of pixels set since the start.
+func (s *Server) Pixels() uint64 {
+	return s.pixels.Load()
+}
+
+// Close stops accepting and hangs up on every client.
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for _, l := range s.listeners {
+		l.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// limiter is a token bucket of commands, holding up to a second worth.
+type limiter struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// take takes a command, sleeping until there is one.
+func (l *limiter) take() {
+	if l.rate <= 0 {
+		return
+	}
+	if l.tokens--; l.tokens >= 0 {
+		return
+	}
+	now := time.Now()
+	if l.last.IsZero() {
+		// a new connection starts with a full bucket
+		l.tokens, l.last = l.rate-1, now
+		return
+	}
+	l.tokens = min(l.rate, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	if l.tokens < 0 {
+		wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+		time.Sleep(wait)
+		l.tokens = 0
+		l.last = now.Add(wait)
+	}
+}
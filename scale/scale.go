@@ -0,0 +1,259 @@
+// Package scale resizes source images to the panel size following a
+// scaling policy, so non-square logos aren't distorted and pixel art
+// stays sharp.
+package scale
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// Mode selects how the source is fitted into the target size.
+type Mode int
+
+const (
+	// Stretch scales both axes independently to the target size.
+	Stretch Mode = iota
+	// Fit keeps the aspect ratio and letterboxes with the background.
+	Fit
+	// Fill keeps the aspect ratio and crops what doesn't fit.
+	Fill
+	// Center doesn't scale at all and crops or pads the source.
+	Center
+	// Integer scales by the largest whole factor with nearest neighbor,
+	// for pixel art.
+	Integer
+)
+
+var modeNames = []string{"stretch", "fit", "fill", "center", "integer"}
+
+func (m Mode) String() string {
+	if m < 0 || int(m) >= len(modeNames) {
+		return "Mode(" + strconv.Itoa(int(m)) + ")"
+	}
+	return modeNames[m]
+}
+
+// Gravity decides where the image is placed when it doesn't cover the
+// target, and which part is kept when it is cropped.
+type Gravity int
+
+const (
+	Middle Gravity = iota
+	North
+	South
+	East
+	West
+	NorthEast
+	NorthWest
+	SouthEast
+	SouthWest
+)
+
+var gravityNames = []string{"center", "north", "south", "east", "west", "northeast", "northwest", "southeast", "southwest"}
+var gravityShort = []string{"c", "n", "s", "e", "w", "ne", "nw", "se", "sw"}
+
+func (g Gravity) String() string {
+	if g < 0 || int(g) >= len(gravityNames) {
+		return "Gravity(" + strconv.Itoa(int(g)) + ")"
+	}
+	return gravityNames[g]
+}
+
+// Filter is the interpolation used for scaling.
+type Filter int
+
+const (
+	ApproxBiLinear Filter = iota
+	NearestNeighbor
+	BiLinear
+	CatmullRom
+)
+
+var filterNames = []string{"approxbilinear", "nearest", "bilinear", "catmullrom"}
+
+func (f Filter) String() string {
+	if f < 0 || int(f) >= len(filterNames) {
+		return "Filter(" + strconv.Itoa(int(f)) + ")"
+	}
+	return filterNames[f]
+}
+
+func (f Filter) interpolator() draw.Interpolator {
+	switch f {
+	case NearestNeighbor:
+		return draw.NearestNeighbor
+	case BiLinear:
+		return draw.BiLinear
+	case CatmullRom:
+		return draw.CatmullRom
+	}
+	return draw.ApproxBiLinear
+}
+
+// Policy describes how images are scaled. The zero value stretches with
+// ApproxBiLinear onto black.
+type Policy struct {
+	Mode       Mode
+	Gravity    Gravity
+	Filter     Filter
+	Background color.RGBA
+}
+
+func (p Policy) String() string {
+	bg := p.Background
+	return fmt.Sprintf("%s-%s-%s-%02x%02x%02x%02x", p.Mode, p.Gravity, p.Filter, bg.R, bg.G, bg.B, bg.A)
+}
+
+// Scale returns src resized to width x height.
+func (p Policy) Scale(src image.Image, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	if p.Background != (color.RGBA{}) {
+		draw.Draw(dst, dst.Rect, image.NewUniform(p.Background), image.Point{}, draw.Src)
+	}
+
+	sb := src.Bounds()
+	if sb.Empty() || width <= 0 || height <= 0 {
+		return dst
+	}
+	sw, sh := sb.Dx(), sb.Dy()
+	dr, sr := dst.Rect, sb
+	filter := p.Filter
+
+	switch p.Mode {
+	case Fit:
+		if sw*height > sh*width {
+			dr = p.place(image.Pt(width, max(1, sh*width/sw)), dst.Rect)
+		} else {
+			dr = p.place(image.Pt(max(1, sw*height/sh), height), dst.Rect)
+		}
+	case Fill:
+		if sw*height > sh*width {
+			sr = p.place(image.Pt(max(1, width*sh/height), sh), sb)
+		} else {
+			sr = p.place(image.Pt(sw, max(1, height*sw/width)), sb)
+		}
+	case Center:
+		size := image.Pt(min(sw, width), min(sh, height))
+		dr = p.place(size, dst.Rect)
+		sr = p.place(size, sb)
+		filter = NearestNeighbor
+	case Integer:
+		var size image.Point
+		if k := min(width/sw, height/sh); k >= 1 {
+			size = image.Pt(sw*k, sh*k)
+		} else {
+			d := max((sw+width-1)/width, (sh+height-1)/height)
+			size = image.Pt(max(1, sw/d), max(1, sh/d))
+		}
+		dr = p.place(size, dst.Rect)
+		filter = NearestNeighbor
+	}
+
+	filter.interpolator().Scale(dst, dr, src, sr, draw.Over, nil)
+	return dst
+}
+
+// place returns a rectangle of the given size inside r, positioned by
+// the policy's gravity.
+func (p Policy) place(size image.Point, r image.Rectangle) image.Rectangle {
+	x := r.Min.X + (r.Dx()-size.X)/2
+	y := r.Min.Y + (r.Dy()-size.Y)/2
+	switch p.Gravity {
+	case West, NorthWest, SouthWest:
+		x = r.Min.X
+	case East, NorthEast, SouthEast:
+		x = r.Max.X - size.X
+	}
+	switch p.Gravity {
+	case North, NorthEast, NorthWest:
+		y = r.Min.Y
+	case South, SouthEast, SouthWest:
+		y = r.Max.Y - size.Y
+	}
+	return image.Rectangle{image.Pt(x, y), image.Pt(x+size.X, y+size.Y)}
+}
+
+// ParsePolicy builds a policy from the textual flag values, e.g.
+// ParsePolicy("fit", "center", "catmullrom", "000000").
+func ParsePolicy(mode, gravity, filter, background string) (Policy, error) {
+	var p Policy
+	var err error
+	if p.Mode, err = ParseMode(mode); err != nil {
+		return p, err
+	}
+	if p.Gravity, err = ParseGravity(gravity); err != nil {
+		return p, err
+	}
+	if p.Filter, err = ParseFilter(filter); err != nil {
+		return p, err
+	}
+	if p.Background, err = ParseColor(background); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+// ParseMode parses one of stretch, fit, fill, center or integer.
+func ParseMode(s string) (Mode, error) {
+	if i := index(modeNames, s); i >= 0 {
+		return Mode(i), nil
+	}
+	return 0, fmt.Errorf("unknown scaling mode %q, use one of %s", s, strings.Join(modeNames, ", "))
+}
+
+// ParseGravity parses a compass direction like north or ne, or center.
+func ParseGravity(s string) (Gravity, error) {
+	if i := index(gravityNames, s); i >= 0 {
+		return Gravity(i), nil
+	}
+	if i := index(gravityShort, s); i >= 0 {
+		return Gravity(i), nil
+	}
+	return 0, fmt.Errorf("unknown gravity %q, use one of %s", s, strings.Join(gravityNames, ", "))
+}
+
+// ParseFilter parses one of approxbilinear, nearest, bilinear or catmullrom.
+func ParseFilter(s string) (Filter, error) {
+	if i := index(filterNames, s); i >= 0 {
+		return Filter(i), nil
+	}
+	return 0, fmt.Errorf("unknown filter %q, use one of %s", s, strings.Join(filterNames, ", "))
+}
+
+// ParseColor parses a hex color as rrggbb or rrggbbaa, with or without a
+// leading #. The alpha is not premultiplied in s, but is in the result.
+// The empty string is transparent black.
+func ParseColor(s string) (color.RGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	if s == "" {
+		return color.RGBA{}, nil
+	}
+	if len(s) != 6 && len(s) != 8 {
+		return color.RGBA{}, fmt.Errorf("invalid color %q, use rrggbb", s)
+	}
+	if len(s) == 6 {
+		s += "ff"
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q, use rrggbb", s)
+	}
+	c := color.NRGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}
+	return color.RGBAModel.Convert(c).(color.RGBA), nil
+}
+
+func index(names []string, s string) int {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for i, name := range names {
+		if name == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,97 @@
+package slideshow
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Item is an entry of a playlist: an image, or a directory standing
+// for all images in it, and how long each is shown, 0 for the default.
+type Item struct {
+	Path string
+	Time time.Duration
+}
+
+// Playlist plays its items in order and starts over at the end.
+// Directories are read again every round, so it picks up new files
+// without watching them.
+type Playlist struct {
+	Items []Item
+
+	mu    sync.Mutex
+	queue []Item
+}
+
+// ParsePlaylist parses a comma separated list of files and directories,
+// each optionally followed by =duration, like
+// "intro.gif=30s,/srv/bilder".
+func ParsePlaylist(s string) (*Playlist, error) {
+	p := &Playlist{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		item := Item{Path: part}
+		if path, d, ok := strings.Cut(part, "="); ok {
+			t, err := time.ParseDuration(d)
+			if err != nil {
+				return nil, fmt.Errorf("playlist entry %q: %v", part, err)
+			}
+			item = Item{Path: path, Time: t}
+		}
+		if _, err := os.Stat(item.Path); err != nil {
+			return nil, err
+		}
+		p.Items = append(p.Items, item)
+	}
+	if len(p.Items) == 0 {
+		return nil, fmt.Errorf("empty playlist")
+	}
+	return p, nil
+}
+
+// Next returns the next image and how long to show it. ok is false if
+// none of the items holds an image right now.
+func (p *Playlist) Next() (item Item, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.queue) == 0 {
+		p.queue = p.round()
+		if len(p.queue) == 0 {
+			return Item{}, false
+		}
+	}
+	item, p.queue = p.queue[0], p.queue[1:]
+	return item, true
+}
+
+// round expands the items into the images of one round.
+func (p *Playlist) round() []Item {
+	var queue []Item
+	for _, item := range p.Items {
+		info, err := os.Stat(item.Path)
+		if err != nil {
+			log.Printf("playlist: %v", err)
+			continue
+		}
+		if !info.IsDir() {
+			queue = append(queue, item)
+			continue
+		}
+		files, err := scan(item.Path)
+		if err != nil {
+			log.Printf("playlist: %v", err)
+			continue
+		}
+		for _, name := range files {
+			queue = append(queue, Item{Path: filepath.Join(item.Path, name), Time: item.Time})
+		}
+	}
+	return queue
+}
@@ -0,0 +1,162 @@
+// Package slideshow keeps an ordered list of the images in a directory
+// and follows changes to it, so files copied in while the matrix is
+// running show up in the next round. A Playlist plays a fixed list of
+// files and directories instead.
+package slideshow
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Extensions lists the file types that are picked up, in lower case.
+var Extensions = []string{".png", ".gif", ".jpg", ".jpeg"}
+
+// Slideshow iterates the images of Dir in name order, wrapping around
+// at the end.
+type Slideshow struct {
+	Dir string
+
+	mu      sync.Mutex
+	files   []string
+	last    string
+	watcher *fsnotify.Watcher
+}
+
+// New scans dir for images.
+func New(dir string) (*Slideshow, error) {
+	s := &Slideshow{Dir: dir}
+	if err := s.Rescan(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Rescan reads the directory again.
+func (s *Slideshow) Rescan() error {
+	files, err := scan(s.Dir)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.files = files
+	s.mu.Unlock()
+	return nil
+}
+
+// Len returns the number of images currently in the slideshow.
+func (s *Slideshow) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.files)
+}
+
+// Next returns the path of the image following the one returned last.
+// New files sorting after the current one are shown in this round,
+// deleted ones are skipped. ok is false if the directory holds no images.
+func (s *Slideshow) Next() (path string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.files) == 0 {
+		return "", false
+	}
+	i := sort.SearchStrings(s.files, s.last)
+	if i < len(s.files) && s.files[i] == s.last {
+		i++
+	}
+	if i >= len(s.files) {
+		i = 0
+	}
+	s.last = s.files[i]
+	return filepath.Join(s.Dir, s.last), true
+}
+
+// Watch follows the directory with inotify until Close is called.
+func (s *Slideshow) Watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(s.Dir); err != nil {
+		watcher.Close()
+		return fmt.Errorf("watch %s: %v", s.Dir, err)
+	}
+
+	s.mu.Lock()
+	s.watcher = watcher
+	s.mu.Unlock()
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !supported(event.Name) {
+					continue
+				}
+				switch {
+				case event.Has(fsnotify.Create), event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+					if err := s.Rescan(); err != nil {
+						log.Printf("slideshow: %v", err)
+					} else {
+						log.Printf("slideshow: %s changed, %d images", s.Dir, s.Len())
+					}
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("slideshow: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Close stops watching the directory.
+func (s *Slideshow) Close() error {
+	s.mu.Lock()
+	watcher := s.watcher
+	s.watcher = nil
+	s.mu.Unlock()
+	if watcher == nil {
+		return nil
+	}
+	return watcher.Close()
+}
+
+// scan returns the names of the images in dir, sorted.
+func scan(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && supported(entry.Name()) {
+			files = append(files, entry.Name())
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func supported(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range Extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
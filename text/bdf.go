@@ -0,0 +1,177 @@
+package text
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ParseBDF reads a font in the Glyph Bitmap Distribution Format. The
+// encodings are taken as Unicode code points, which holds for fonts in
+// ISO10646 and ISO8859-1.
+func ParseBDF(r io.Reader) (*Bitmap, error) {
+	b := newBitmap()
+	s := bufio.NewScanner(r)
+	line := 0
+	next := func() (string, []string, bool) {
+		for s.Scan() {
+			line++
+			fields := strings.Fields(s.Text())
+			if len(fields) > 0 {
+				return fields[0], fields[1:], true
+			}
+		}
+		return "", nil, false
+	}
+	fail := func(format string, args ...interface{}) error {
+		return fmt.Errorf("bdf line %d: %s", line, fmt.Sprintf(format, args...))
+	}
+
+	var (
+		box         image.Rectangle // font bounding box, relative to the dot
+		defaultChar = rune(-1)
+		haveAscent  bool
+		haveDescent bool
+	)
+	keyword, _, ok := next()
+	if !ok || keyword != "STARTFONT" {
+		return nil, fmt.Errorf("bdf: not a BDF font")
+	}
+
+	for {
+		keyword, args, ok := next()
+		if !ok {
+			return nil, fail("unexpected end of file")
+		}
+		ints, err := atois(args)
+
+		switch keyword {
+		case "FONT":
+			b.Name = strings.Join(args, " ")
+		case "FONTBOUNDINGBOX":
+			if err != nil || len(ints) != 4 || !bdfSize(ints[0], ints[1]) {
+				return nil, fail("bad FONTBOUNDINGBOX")
+			}
+			box = image.Rect(ints[2], -(ints[3] + ints[1]), ints[2]+ints[0], -ints[3])
+		case "FONT_ASCENT":
+			if err != nil || len(ints) != 1 {
+				return nil, fail("bad FONT_ASCENT")
+			}
+			b.Ascent, haveAscent = ints[0], true
+		case "FONT_DESCENT":
+			if err != nil || len(ints) != 1 {
+				return nil, fail("bad FONT_DESCENT")
+			}
+			b.Descent, haveDescent = ints[0], true
+		case "DEFAULT_CHAR":
+			if err == nil && len(ints) == 1 {
+				defaultChar = rune(ints[0])
+			}
+		case "STARTCHAR":
+			if err := parseBDFChar(b, box, next); err != nil {
+				return nil, fail("%v", err)
+			}
+		case "ENDFONT":
+			if !haveAscent {
+				b.Ascent = -box.Min.Y
+			}
+			if !haveDescent {
+				b.Descent = box.Max.Y
+			}
+			b.finish(defaultChar)
+			return b, nil
+		}
+	}
+}
+
+// parseBDFChar reads one character up to ENDCHAR.
+func parseBDFChar(b *Bitmap, box image.Rectangle, next func() (string, []string, bool)) error {
+	encoding := -1
+	g := &glyph{bounds: box, advance: box.Dx()}
+	for {
+		keyword, args, ok := next()
+		if !ok {
+			return fmt.Errorf("unexpected end of file in character")
+		}
+		ints, err := atois(args)
+
+		switch keyword {
+		case "ENCODING":
+			if err != nil || len(ints) == 0 {
+				return fmt.Errorf("bad ENCODING")
+			}
+			encoding = ints[0]
+			if encoding == -1 && len(ints) == 2 {
+				encoding = ints[1]
+			}
+		case "DWIDTH":
+			if err != nil || len(ints) != 2 {
+				return fmt.Errorf("bad DWIDTH")
+			}
+			g.advance = ints[0]
+		case "BBX":
+			if err != nil || len(ints) != 4 || !bdfSize(ints[0], ints[1]) {
+				return fmt.Errorf("bad BBX")
+			}
+			g.bounds = image.Rect(ints[2], -(ints[3] + ints[1]), ints[2]+ints[0], -ints[3])
+		case "BITMAP":
+			g.mask = image.NewAlpha(image.Rect(0, 0, g.bounds.Dx(), g.bounds.Dy()))
+			for y := 0; y < g.bounds.Dy(); y++ {
+				row, _, ok := next()
+				if !ok {
+					return fmt.Errorf("unexpected end of file in bitmap")
+				}
+				bits, err := hex.DecodeString(row)
+				if err != nil {
+					return fmt.Errorf("bad bitmap row %q", row)
+				}
+				setRow(g.mask, y, bits, true)
+			}
+		case "ENDCHAR":
+			if encoding >= 0 && g.mask != nil {
+				b.glyphs[rune(encoding)] = g
+			}
+			return nil
+		}
+	}
+}
+
+// maxGlyphSize is the largest glyph width or height a BDF font may
+// declare, far beyond anything fitting the wall.
+const maxGlyphSize = 1024
+
+// bdfSize reports whether a glyph of w by h pixels is within
+// maxGlyphSize.
+func bdfSize(w, h int) bool {
+	return w >= 0 && h >= 0 && w <= maxGlyphSize && h <= maxGlyphSize
+}
+
+// setRow sets row y of mask from bits, most or least significant bit
+// first.
+func setRow(mask *image.Alpha, y int, bits []byte, msbFirst bool) {
+	for x := 0; x < mask.Rect.Dx() && x/8 < len(bits); x++ {
+		bit := bits[x/8] >> (7 - x%8) & 1
+		if !msbFirst {
+			bit = bits[x/8] >> (x % 8) & 1
+		}
+		if bit != 0 {
+			mask.Pix[y*mask.Stride+x] = 0xff
+		}
+	}
+}
+
+func atois(args []string) ([]int, error) {
+	ints := make([]int, len(args))
+	for i, a := range args {
+		n, err := strconv.Atoi(a)
+		if err != nil {
+			return nil, err
+		}
+		ints[i] = n
+	}
+	return ints, nil
+}
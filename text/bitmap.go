@@ -0,0 +1,104 @@
+package text
+
+import (
+	"image"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// Bitmap is a bitmap font loaded from a BDF or PCF file. It draws at
+// its native size, pixel for pixel.
+type Bitmap struct {
+	Name            string
+	Ascent, Descent int
+
+	glyphs   map[rune]*glyph
+	fallback *glyph
+}
+
+// glyph is one character of a bitmap font. bounds are relative to the
+// dot, with y growing downwards.
+type glyph struct {
+	mask    *image.Alpha
+	bounds  image.Rectangle
+	advance int
+}
+
+func newBitmap() *Bitmap {
+	return &Bitmap{glyphs: make(map[rune]*glyph)}
+}
+
+// finish picks the glyph drawn for missing characters.
+func (b *Bitmap) finish(defaultChar rune) {
+	for _, r := range []rune{defaultChar, '\ufffd', '?'} {
+		if g, ok := b.glyphs[r]; ok {
+			b.fallback = g
+			return
+		}
+	}
+}
+
+// lookup returns the glyph for r, or the fallback glyph with ok false.
+// Like basicfont, missing characters are still drawn as the fallback.
+func (b *Bitmap) lookup(r rune) (g *glyph, ok bool) {
+	if g, ok := b.glyphs[r]; ok {
+		return g, true
+	}
+	return b.fallback, false
+}
+
+// Glyph implements font.Face.
+func (b *Bitmap) Glyph(dot fixed.Point26_6, r rune) (dr image.Rectangle, mask image.Image, maskp image.Point, advance fixed.Int26_6, ok bool) {
+	g, ok := b.lookup(r)
+	if g == nil {
+		return image.Rectangle{}, nil, image.Point{}, 0, false
+	}
+	dr = g.bounds.Add(image.Pt(dot.X.Round(), dot.Y.Round()))
+	return dr, g.mask, g.mask.Rect.Min, fixed.I(g.advance), ok
+}
+
+// GlyphBounds implements font.Face.
+func (b *Bitmap) GlyphBounds(r rune) (bounds fixed.Rectangle26_6, advance fixed.Int26_6, ok bool) {
+	g, ok := b.lookup(r)
+	if g == nil {
+		return fixed.Rectangle26_6{}, 0, false
+	}
+	bounds = fixed.R(g.bounds.Min.X, g.bounds.Min.Y, g.bounds.Max.X, g.bounds.Max.Y)
+	return bounds, fixed.I(g.advance), ok
+}
+
+// GlyphAdvance implements font.Face.
+func (b *Bitmap) GlyphAdvance(r rune) (advance fixed.Int26_6, ok bool) {
+	g, ok := b.lookup(r)
+	if g == nil {
+		return 0, false
+	}
+	return fixed.I(g.advance), ok
+}
+
+// Kern implements font.Face. Bitmap fonts have no kerning.
+func (b *Bitmap) Kern(r0, r1 rune) fixed.Int26_6 {
+	return 0
+}
+
+// Metrics implements font.Face.
+func (b *Bitmap) Metrics() font.Metrics {
+	m := font.Metrics{
+		Height:  fixed.I(b.Ascent + b.Descent),
+		Ascent:  fixed.I(b.Ascent),
+		Descent: fixed.I(b.Descent),
+	}
+	if g, ok := b.glyphs['x']; ok {
+		m.XHeight = fixed.I(-g.bounds.Min.Y)
+	}
+	if g, ok := b.glyphs['H']; ok {
+		m.CapHeight = fixed.I(-g.bounds.Min.Y)
+	}
+	return m
+}
+
+// Close implements font.Face.
+func (b *Bitmap) Close() error {
+	return nil
+}
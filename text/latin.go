@@ -0,0 +1,138 @@
+package text
+
+import (
+	"image"
+	"strings"
+
+	"golang.org/x/image/font/basicfont"
+)
+
+// extra7x13 are the glyphs basicfont.Face7x13 lacks for German text,
+// drawn in its style, 6 pixels wide with the baseline below row 10.
+var extra7x13 = []struct {
+	r    rune
+	rows string
+}{
+	{'°', `
+		......
+		......
+		..XX..
+		.X..X.
+		.X..X.
+		..XX..`},
+	{'Ä', `
+		.X..X.
+		......
+		..XX..
+		.X..X.
+		X....X
+		X....X
+		X....X
+		XXXXXX
+		X....X
+		X....X
+		X....X`},
+	{'Ö', `
+		.X..X.
+		......
+		.XXXX.
+		X....X
+		X....X
+		X....X
+		X....X
+		X....X
+		X....X
+		X....X
+		.XXXX.`},
+	{'Ü', `
+		.X..X.
+		......
+		X....X
+		X....X
+		X....X
+		X....X
+		X....X
+		X....X
+		X....X
+		X....X
+		.XXXX.`},
+	{'ß', `
+		......
+		......
+		.XXX..
+		X...X.
+		X...X.
+		X.XX..
+		X...X.
+		X....X
+		X....X
+		X...X.
+		X.XX..`},
+	{'ä', `
+		......
+		......
+		......
+		.X..X.
+		......
+		.XXXX.
+		.....X
+		.XXXXX
+		X....X
+		X...XX
+		.XXX.X`},
+	{'ö', `
+		......
+		......
+		......
+		.X..X.
+		......
+		.XXXX.
+		X....X
+		X....X
+		X....X
+		X....X
+		.XXXX.`},
+	{'ü', `
+		......
+		......
+		......
+		.X..X.
+		......
+		X....X
+		X....X
+		X....X
+		X....X
+		X...XX
+		.XXX.X`},
+}
+
+// Face7x13 is basicfont.Face7x13 with the German umlauts, ß and the
+// degree sign added. It is the default font of the labels.
+var Face7x13 = extend7x13()
+
+func extend7x13() *basicfont.Face {
+	base := basicfont.Face7x13
+	src := base.Mask.(*image.Alpha)
+	glyphs := src.Rect.Dy() / base.Height
+
+	mask := image.NewAlpha(image.Rect(0, 0, src.Rect.Dx(), (glyphs+len(extra7x13))*base.Height))
+	copy(mask.Pix, src.Pix)
+
+	face := *base
+	face.Mask = mask
+	// the ranges stay sorted: ASCII, the extra glyphs, then U+FFFD
+	face.Ranges = []basicfont.Range{base.Ranges[0]}
+	for i, g := range extra7x13 {
+		top := (glyphs + i) * base.Height
+		for y, row := range strings.Fields(g.rows) {
+			for x, c := range row {
+				if c == 'X' {
+					mask.Pix[(top+y)*mask.Stride+x] = 0xff
+				}
+			}
+		}
+		face.Ranges = append(face.Ranges, basicfont.Range{Low: g.r, High: g.r + 1, Offset: glyphs + i})
+	}
+	face.Ranges = append(face.Ranges, base.Ranges[1:]...)
+	return &face
+}
@@ -0,0 +1,230 @@
+package text
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+)
+
+// PCF table types and format bits, see the X.Org pcf font format
+// documentation.
+const (
+	pcfAccelerators    = 1 << 1
+	pcfMetrics         = 1 << 2
+	pcfBitmaps         = 1 << 3
+	pcfBDFEncodings    = 1 << 5
+	pcfBDFAccelerators = 1 << 8
+
+	pcfCompressedMetrics = 0x100
+	pcfGlyphPadMask      = 3
+	pcfByteMask          = 1 << 2 // most significant byte first
+	pcfBitMask           = 1 << 3 // most significant bit first
+	pcfScanUnitMask      = 3 << 4
+)
+
+// ParsePCF reads a font in the Portable Compiled Format, as installed by
+// X11 and the console font packages.
+func ParsePCF(data []byte) (*Bitmap, error) {
+	if len(data) < 8 || string(data[:4]) != "\x01fcp" {
+		return nil, fmt.Errorf("pcf: not a PCF font")
+	}
+	tables := make(map[uint32][]byte)
+	count := binary.LittleEndian.Uint32(data[4:])
+	for i := uint32(0); i < count; i++ {
+		toc := data[8+i*16:]
+		if len(toc) < 16 {
+			return nil, fmt.Errorf("pcf: truncated table of contents")
+		}
+		typ := binary.LittleEndian.Uint32(toc)
+		size := binary.LittleEndian.Uint32(toc[8:])
+		offset := binary.LittleEndian.Uint32(toc[12:])
+		if uint64(offset)+uint64(size) > uint64(len(data)) {
+			return nil, fmt.Errorf("pcf: table %#x out of range", typ)
+		}
+		tables[typ] = data[offset : offset+size]
+	}
+
+	metrics, err := pcfReadMetrics(tables[pcfMetrics])
+	if err != nil {
+		return nil, err
+	}
+	b := newBitmap()
+	if err := pcfReadBitmaps(tables[pcfBitmaps], metrics); err != nil {
+		return nil, err
+	}
+	accel := tables[pcfBDFAccelerators]
+	if accel == nil {
+		accel = tables[pcfAccelerators]
+	}
+	if b.Ascent, b.Descent, err = pcfReadAccelerators(accel); err != nil {
+		return nil, err
+	}
+	defaultChar, err := pcfReadEncodings(tables[pcfBDFEncodings], metrics, b)
+	if err != nil {
+		return nil, err
+	}
+	b.finish(defaultChar)
+	return b, nil
+}
+
+// pcfTable reads the values of a table in the byte order of its format.
+type pcfTable struct {
+	data   []byte
+	format uint32
+	order  binary.ByteOrder
+	pos    int
+	err    error
+}
+
+func newPCFTable(name string, data []byte) (*pcfTable, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("pcf: missing %s table", name)
+	}
+	t := &pcfTable{data: data, format: binary.LittleEndian.Uint32(data), pos: 4, order: binary.LittleEndian}
+	if t.format&pcfByteMask != 0 {
+		t.order = binary.BigEndian
+	}
+	return t, nil
+}
+
+func (t *pcfTable) bytes(n int) []byte {
+	if t.err != nil || t.pos+n > len(t.data) {
+		t.err = fmt.Errorf("pcf: truncated table")
+		return make([]byte, n)
+	}
+	b := t.data[t.pos : t.pos+n]
+	t.pos += n
+	return b
+}
+
+func (t *pcfTable) u8() int      { return int(t.bytes(1)[0]) }
+func (t *pcfTable) i16() int     { return int(int16(t.order.Uint16(t.bytes(2)))) }
+func (t *pcfTable) u16() int     { return int(t.order.Uint16(t.bytes(2))) }
+func (t *pcfTable) i32() int     { return int(int32(t.order.Uint32(t.bytes(4)))) }
+func (t *pcfTable) skip(n int)   { t.bytes(n) }
+func (t *pcfTable) failed() bool { return t.err != nil }
+
+func pcfReadMetrics(data []byte) ([]*glyph, error) {
+	t, err := newPCFTable("metrics", data)
+	if err != nil {
+		return nil, err
+	}
+	var n int
+	compressed := t.format&pcfCompressedMetrics != 0
+	if compressed {
+		n = t.i16()
+	} else {
+		n = t.i32()
+	}
+	if n < 0 || n > len(data) {
+		return nil, fmt.Errorf("pcf: bad glyph count %d", n)
+	}
+	glyphs := make([]*glyph, n)
+	for i := range glyphs {
+		var left, right, width, ascent, descent int
+		if compressed {
+			left, right, width, ascent, descent = t.u8()-0x80, t.u8()-0x80, t.u8()-0x80, t.u8()-0x80, t.u8()-0x80
+		} else {
+			left, right, width, ascent, descent = t.i16(), t.i16(), t.i16(), t.i16(), t.i16()
+			t.skip(2) // attributes
+		}
+		glyphs[i] = &glyph{bounds: image.Rect(left, -ascent, right, descent), advance: width}
+	}
+	if t.failed() {
+		return nil, t.err
+	}
+	return glyphs, nil
+}
+
+func pcfReadBitmaps(data []byte, glyphs []*glyph) error {
+	t, err := newPCFTable("bitmaps", data)
+	if err != nil {
+		return err
+	}
+	if n := t.i32(); n != len(glyphs) {
+		return fmt.Errorf("pcf: %d bitmaps for %d glyphs", n, len(glyphs))
+	}
+	offsets := make([]int, len(glyphs))
+	for i := range offsets {
+		offsets[i] = t.i32()
+	}
+	var sizes [4]int
+	for i := range sizes {
+		sizes[i] = t.i32()
+	}
+	bits := t.bytes(sizes[t.format&pcfGlyphPadMask])
+	if t.failed() {
+		return t.err
+	}
+
+	pad := 1 << (t.format & pcfGlyphPadMask)
+	unit := 1 << (t.format & pcfScanUnitMask >> 4)
+	msbFirst := t.format&pcfBitMask != 0
+	swap := unit > 1 && (t.format&pcfByteMask != 0) != msbFirst
+	for i, g := range glyphs {
+		w, h := g.bounds.Dx(), g.bounds.Dy()
+		stride := (w + 7) / 8
+		stride = (stride + pad - 1) / pad * pad
+		if offsets[i] < 0 || stride*h > len(bits)-offsets[i] {
+			return fmt.Errorf("pcf: bitmap %d out of range", i)
+		}
+		g.mask = image.NewAlpha(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			start := offsets[i] + y*stride
+			if start < 0 || start+stride > len(bits) {
+				return fmt.Errorf("pcf: bitmap %d out of range", i)
+			}
+			row := bits[start : start+stride]
+			if swap {
+				row = swapUnits(row, unit)
+			}
+			setRow(g.mask, y, row, msbFirst)
+		}
+	}
+	return nil
+}
+
+// swapUnits reverses the bytes within each scan unit of row. Bytes past
+// the last full unit stay as they are.
+func swapUnits(row []byte, unit int) []byte {
+	out := make([]byte, len(row))
+	for i := range row {
+		if i/unit*unit+unit <= len(row) {
+			out[i] = row[i/unit*unit+unit-1-i%unit]
+		} else {
+			out[i] = row[i]
+		}
+	}
+	return out
+}
+
+func pcfReadAccelerators(data []byte) (ascent, descent int, err error) {
+	t, err := newPCFTable("accelerators", data)
+	if err != nil {
+		return 0, 0, err
+	}
+	t.skip(8) // flags, draw direction and padding
+	ascent, descent = t.i32(), t.i32()
+	return ascent, descent, t.err
+}
+
+func pcfReadEncodings(data []byte, glyphs []*glyph, b *Bitmap) (rune, error) {
+	t, err := newPCFTable("encodings", data)
+	if err != nil {
+		return 0, err
+	}
+	min2, max2, min1, max1 := t.i16(), t.i16(), t.i16(), t.i16()
+	defaultChar := rune(t.i16())
+	for b1 := min1; b1 <= max1; b1++ {
+		for b2 := min2; b2 <= max2; b2++ {
+			index := t.u16()
+			if t.failed() {
+				return 0, t.err
+			}
+			if index != 0xffff && index < len(glyphs) {
+				b.glyphs[rune(b1<<8|b2)] = glyphs[index]
+			}
+		}
+	}
+	return defaultChar, nil
+}
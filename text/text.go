@@ -0,0 +1,134 @@
+// Package text loads fonts and draws aligned UTF-8 text onto the wall.
+//
+// Bitmap fonts in BDF and PCF format draw pixel for pixel at their
+// native size, TrueType and OpenType fonts are rendered at a size in
+// pixels. All of them are used as font.Face.
+package text
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/inconsolata"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Align is the horizontal alignment of text relative to its x position.
+type Align int
+
+const (
+	Left Align = iota
+	Center
+	Right
+)
+
+// builtin are the fonts available without a file.
+var builtin = map[string]font.Face{
+	"7x13": Face7x13,
+	"8x16": inconsolata.Regular8x16,
+}
+
+// Load loads a font by file name, picking the format from the extension:
+// .bdf, .pcf, .ttf, .otf and .ttc, each optionally gzipped. size is the
+// em size in pixels of TrueType and OpenType fonts. The names "7x13"
+// and "8x16" select the built-in fonts, an empty name the default 7x13.
+func Load(filename string, size float64) (font.Face, error) {
+	if filename == "" {
+		return Face7x13, nil
+	}
+	if f, ok := builtin[filename]; ok {
+		return f, nil
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.ToLower(filename)
+	if strings.HasSuffix(name, ".gz") {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		name = strings.TrimSuffix(name, ".gz")
+	}
+
+	var face font.Face
+	switch filepath.Ext(name) {
+	case ".bdf":
+		face, err = ParseBDF(bytes.NewReader(data))
+	case ".pcf":
+		face, err = ParsePCF(data)
+	case ".ttf", ".otf", ".ttc", ".otc":
+		face, err = parseOpenType(data, size)
+	default:
+		return nil, fmt.Errorf("%s: unknown font format, use bdf, pcf, ttf or otf", filename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return face, nil
+}
+
+// parseOpenType renders the font, or the first font of a collection, at
+// size pixels with full hinting, which keeps stems on whole pixels.
+func parseOpenType(data []byte, size float64) (font.Face, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("font size must be positive")
+	}
+	f, err := opentype.Parse(data)
+	if err != nil {
+		c, cerr := opentype.ParseCollection(data)
+		if cerr != nil {
+			return nil, err
+		}
+		if f, err = c.Font(0); err != nil {
+			return nil, err
+		}
+	}
+	return opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+}
+
+// Measure returns the advance width of s in pixels.
+func Measure(face font.Face, s string) int {
+	return font.MeasureString(face, s).Ceil()
+}
+
+// Bounds returns the pixels s covers when drawn with the dot at the
+// origin.
+func Bounds(face font.Face, s string) image.Rectangle {
+	b, _ := font.BoundString(face, s)
+	return image.Rect(b.Min.X.Floor(), b.Min.Y.Floor(), b.Max.X.Ceil(), b.Max.Y.Ceil())
+}
+
+// Draw draws s with its baseline at y, aligned to x, and returns the
+// x position after the text.
+func Draw(dst draw.Image, face font.Face, x, y int, s string, col color.Color, align Align) int {
+	switch align {
+	case Center:
+		x -= Measure(face, s) / 2
+	case Right:
+		x -= Measure(face, s)
+	}
+	d := &font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(col),
+		Face: face,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(s)
+	return d.Dot.X.Ceil()
+}
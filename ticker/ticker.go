@@ -0,0 +1,265 @@
+package main
+
+import (
+	"flag"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/image/font"
+
+	"github.com/SimonWaldherr/RGB-LED-Matrix/config"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/health"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/marquee"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/mqtt"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/panel"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/scale"
+	"github.com/SimonWaldherr/RGB-LED-Matrix/text"
+)
+
+var hardware = config.MatrixFlags(flag.CommandLine)
+var settings = panel.Flags(flag.CommandLine)
+var broker = mqtt.Flags(flag.CommandLine, "ticker")
+
+var (
+	setfps       int
+	setfilename  string
+	setgoodbye   string
+	setgoodbyet  time.Duration
+	sethealth    string
+	setstale     time.Duration
+	setstdin     bool
+	sethttp      string
+	setspeed     float64
+	setdirection string
+	setfont      string
+	setfontsize  float64
+	setfg        string
+	setbg        string
+	seticons     string
+	setmax       int
+	setpause     time.Duration
+)
+
+func fatal(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+var out *panel.Output
+var panels *panel.Panels
+var monitor *health.Monitor
+var reloader *config.Reloader
+var remote *mqtt.Client
+
+// style is how messages look, set by loadStyle on the render loop. The
+// render loop reads it freely, messages are parsed on other goroutines,
+// so setting it and parse hold styleMu.
+var styleMu sync.Mutex
+var style struct {
+	direction marquee.Direction
+	align     text.Align
+	face      font.Face
+	fg, bg    color.RGBA
+	icons     *marquee.Icons
+}
+
+// loadStyle sets style from the flags. On errors the old style stays.
+func loadStyle() error {
+	direction, err := marquee.ParseDirection(setdirection)
+	if err != nil {
+		return err
+	}
+	face, err := text.Load(setfont, setfontsize)
+	if err != nil {
+		return err
+	}
+	fg, err := scale.ParseColor(setfg)
+	if err != nil {
+		return err
+	}
+	bg, err := scale.ParseColor(setbg)
+	if err != nil {
+		return err
+	}
+
+	// vertical scrolling centers the lines, horizontal keeps them left
+	align := text.Left
+	if direction == marquee.Up || direction == marquee.Down {
+		align = text.Center
+	}
+
+	styleMu.Lock()
+	defer styleMu.Unlock()
+	style.direction, style.align, style.face = direction, align, face
+	style.fg, style.bg = fg, bg
+	style.icons = &marquee.Icons{Dir: seticons, Height: face.Metrics().Height.Ceil()}
+	return nil
+}
+
+// parse parses a message in the current text color.
+func parse(s string) marquee.Message {
+	styleMu.Lock()
+	fg := style.fg
+	styleMu.Unlock()
+	return marquee.Parse(s, fg)
+}
+
+// render renders the frame, applying changed settings first.
+func render() error {
+	reload()
+	return out.Render()
+}
+
+// scroll shows one message, scrolling it through the wall until it has
+// left on the other side.
+func scroll(strip *image.RGBA, direction marquee.Direction, pacer <-chan time.Time) error {
+	start := time.Now()
+	for range pacer {
+		p, ok := marquee.Position(direction, strip.Rect.Size(), panel.Width, panel.Height, time.Since(start), setspeed)
+		if !ok {
+			return nil
+		}
+		frame := out.Frame()
+		draw.Draw(frame, strip.Rect.Add(p), strip, image.Point{}, draw.Over)
+		if err := render(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func main() {
+	flag.IntVar(&setfps, "f", 50, "frames per second")
+	flag.StringVar(&setfilename, "o", "", "message file, one message per line, reloaded on change")
+	flag.BoolVar(&setstdin, "stdin", false, "read messages from stdin, one per line")
+	flag.StringVar(&sethttp, "http", "", "address to accept messages over HTTP, e.g. :8080")
+	flag.Float64Var(&setspeed, "speed", 32, "scroll speed in pixels per second")
+	flag.StringVar(&setdirection, "direction", "left", "scroll direction: left, right, up or down")
+	flag.StringVar(&setfont, "font", "7x13", "font: 7x13, 8x16 or a BDF, PCF, TTF or OTF file")
+	flag.Float64Var(&setfontsize, "font-size", 13, "size of TrueType and OpenType fonts in pixels")
+	flag.StringVar(&setfg, "fg", "ffffff", "default text color (rrggbb)")
+	flag.StringVar(&setbg, "bg", "000000", "background color (rrggbb)")
+	flag.StringVar(&seticons, "icons", "", "directory with PNG icons for {name} and emoji like 1f600.png")
+	flag.IntVar(&setmax, "max", 50, "number of messages kept in the loop, 0 for all")
+	flag.DurationVar(&setpause, "pause", 0, "pause between messages")
+
+	flag.StringVar(&setgoodbye, "goodbye", "", "image shown when stopped with SIGINT or SIGTERM, empty for black")
+	flag.DurationVar(&setgoodbyet, "goodbye-time", 2*time.Second, "how long the goodbye image is shown")
+	flag.StringVar(&sethealth, "health", "", "address for the /healthz and /metrics endpoints, e.g. localhost:9100")
+	flag.DurationVar(&setstale, "health-stale", 30*time.Second, "time without a rendered frame after which the program counts as hung")
+
+	fatal(config.Parse("ticker"))
+	reloader = config.Watch()
+
+	var err error
+	panels, err = panel.NewPanels(hardware, settings)
+	fatal(err)
+	goodbye, err := panel.LoadGoodbye(setgoodbye, setgoodbyet)
+	fatal(err)
+	panel.HandleSignals(goodbye, func() { remote.Close() })
+	monitor = health.New(setstale)
+	panels.Monitor = monitor
+	monitor.Gauge("ledmatrix_brightness_percent", "Brightness after dimming.", func() float64 { return float64(panels.Dimmer.Level()) })
+	if sethealth != "" {
+		monitor.Serve(sethealth)
+	}
+	monitor.Watchdog()
+
+	fatal(loadStyle())
+
+	queue := &marquee.Queue{Max: setmax}
+	if setfilename != "" {
+		fatal(marquee.WatchFile(setfilename, 2*time.Second, queue, parse))
+	}
+	if setstdin {
+		go func() {
+			if err := marquee.ReadLines(os.Stdin, queue, parse); err != nil {
+				log.Printf("stdin: %v", err)
+			}
+		}()
+	}
+	if sethttp != "" {
+		http.Handle("/messages", marquee.Handler(queue, parse))
+		go func() {
+			log.Fatal(http.ListenAndServe(sethttp, nil))
+		}()
+		log.Printf("accepting messages on http://%s/messages", sethttp)
+	}
+	if setfilename == "" && !setstdin && sethttp == "" {
+		for _, arg := range flag.Args() {
+			queue.Add(parse(arg))
+		}
+	}
+
+	pacer := time.NewTicker(time.Second / time.Duration(max(1, setfps)))
+	defer pacer.Stop()
+
+	if broker.Broker != "" {
+		remote = mqtt.Connect(*broker, mqtt.Handlers{
+			Level:   func(level int) { panels.Dimmer.Override(level, 0) },
+			Release: func() { panels.Dimmer.ClearOverride() },
+			Scene:   reloader.SetScene,
+			Scenes:  reloader.Scenes,
+			Current: reloader.Scene,
+			Text:    func(s string) error { queue.Add(parse(s)); return nil },
+		})
+	}
+
+	panel.Supervise("ticker", func() error {
+		var err error
+		if out, err = panels.Open(); err != nil {
+			return err
+		}
+		defer out.Close()
+		out.Background = color.RGBA{style.bg.R, style.bg.G, style.bg.B, 255}
+
+		for {
+			msg, ok := queue.Next()
+			if !ok {
+				if err := render(); err != nil {
+					return err
+				}
+				time.Sleep(250 * time.Millisecond)
+				continue
+			}
+			if err := scroll(marquee.Render(msg, style.face, style.icons, style.align), style.direction, pacer.C); err != nil {
+				return err
+			}
+			if setpause > 0 {
+				if err := render(); err != nil {
+					return err
+				}
+				time.Sleep(setpause)
+			}
+		}
+	})
+}
+
+// reload applies changed settings between two frames. The panels are
+// only opened again for new hardware settings, everything else changes
+// in place. Broken settings are logged and the old ones stay in effect.
+func reload() {
+	changed := reloader.Reload()
+	if changed == nil {
+		return
+	}
+	panels.Reload(changed)
+	if changed.Scenes {
+		remote.Announce()
+	}
+
+	if changed.Files("direction", "font", "font-size", "fg", "bg", "icons") {
+		if err := loadStyle(); err != nil {
+			log.Printf("reload: %v", err)
+		} else {
+			out.Background = color.RGBA{style.bg.R, style.bg.G, style.bg.B, 255}
+		}
+	}
+}
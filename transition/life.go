@@ -0,0 +1,116 @@
+package transition
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+)
+
+// Life turns the lit pixels of the old frame into Game of Life cells
+// that live on while the new frame fades in underneath, and fade into
+// it themselves in the second half.
+type Life struct {
+	// Generations is how many rounds are played over the transition,
+	// 24 if 0.
+	Generations int
+	// Threshold is the brightness from 0 to 255 above which a pixel
+	// can start alive, 64 if 0.
+	Threshold uint8
+	// Density is the share of those pixels that start alive, 0.5 if 0.
+	// Solid areas would die out in the first round otherwise.
+	Density float64
+
+	w, h       int
+	generation int
+	alive      []bool
+	next       []bool
+	colors     []color.RGBA
+	nextColors []color.RGBA
+}
+
+// Frame implements Effect.
+func (l *Life) Frame(dst, from, to *image.RGBA, t float64) {
+	r := dst.Rect
+	if t == 0 || l.w != r.Dx() || l.h != r.Dy() {
+		l.seed(from)
+	}
+	generations := l.Generations
+	if generations == 0 {
+		generations = 24
+	}
+	for l.generation < int(t*float64(generations)) {
+		l.step()
+	}
+
+	background := math.Min(1, 3*t)
+	cells := math.Max(0, 2*t-1)
+	for y := 0; y < l.h; y++ {
+		for x := 0; x < l.w; x++ {
+			i := dst.PixOffset(r.Min.X+x, r.Min.Y+y)
+			if k := y*l.w + x; l.alive[k] {
+				c := l.colors[k]
+				mix(dst.Pix[i:i+4], []uint8{c.R, c.G, c.B, c.A}, to.Pix[i:i+4], cells)
+			} else {
+				mix(dst.Pix[i:i+4], from.Pix[i:i+4], to.Pix[i:i+4], background)
+			}
+		}
+	}
+}
+
+func (l *Life) seed(from *image.RGBA) {
+	l.w, l.h = from.Rect.Dx(), from.Rect.Dy()
+	l.generation = 0
+	l.alive = make([]bool, l.w*l.h)
+	l.next = make([]bool, l.w*l.h)
+	l.colors = make([]color.RGBA, l.w*l.h)
+	l.nextColors = make([]color.RGBA, l.w*l.h)
+	threshold := l.Threshold
+	if threshold == 0 {
+		threshold = 64
+	}
+	density := l.Density
+	if density == 0 {
+		density = 0.5
+	}
+	for y := 0; y < l.h; y++ {
+		for x := 0; x < l.w; x++ {
+			c := from.RGBAAt(from.Rect.Min.X+x, from.Rect.Min.Y+y)
+			k := y*l.w + x
+			l.colors[k] = c
+			l.alive[k] = max(c.R, c.G, c.B) >= threshold && rand.Float64() < density
+		}
+	}
+}
+
+// step plays one round on a torus. Newborn cells take the mean color of
+// their parents, like in the colored Game of Life.
+func (l *Life) step() {
+	for y := 0; y < l.h; y++ {
+		for x := 0; x < l.w; x++ {
+			var n, r, g, b, a int
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					if dx == 0 && dy == 0 {
+						continue
+					}
+					k := (y+dy+l.h)%l.h*l.w + (x+dx+l.w)%l.w
+					if l.alive[k] {
+						c := l.colors[k]
+						n++
+						r, g, b, a = r+int(c.R), g+int(c.G), b+int(c.B), a+int(c.A)
+					}
+				}
+			}
+			k := y*l.w + x
+			l.next[k] = n == 3 || n == 2 && l.alive[k]
+			l.nextColors[k] = l.colors[k]
+			if l.next[k] && !l.alive[k] {
+				l.nextColors[k] = color.RGBA{uint8(r / n), uint8(g / n), uint8(b / n), uint8(a / n)}
+			}
+		}
+	}
+	l.alive, l.next = l.next, l.alive
+	l.colors, l.nextColors = l.nextColors, l.colors
+	l.generation++
+}
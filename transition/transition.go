@@ -0,0 +1,213 @@
+// Package transition blends the last frame of one scene into the first
+// frame of the next, instead of cutting to black in between.
+//
+// An Effect computes one frame of the transition for a progress t from
+// 0 to 1. Play runs a whole transition; it always starts with t = 0,
+// which effects with state use to start over.
+package transition
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// Effect draws the transition from from to to at t into dst. All three
+// have the same bounds.
+type Effect interface {
+	Frame(dst, from, to *image.RGBA, t float64)
+}
+
+// EffectFunc adapts a function to an Effect.
+type EffectFunc func(dst, from, to *image.RGBA, t float64)
+
+// Frame calls f(dst, from, to, t).
+func (f EffectFunc) Frame(dst, from, to *image.RGBA, t float64) {
+	f(dst, from, to, t)
+}
+
+// Cut shows to right away.
+var Cut = EffectFunc(func(dst, from, to *image.RGBA, t float64) {
+	copy(dst.Pix, to.Pix)
+})
+
+// Crossfade mixes the two frames.
+var Crossfade = EffectFunc(func(dst, from, to *image.RGBA, t float64) {
+	mix(dst.Pix, from.Pix, to.Pix, t)
+})
+
+// Wipe pushes an edge across the frame in the direction DX, DY, one of
+// them 1 or -1 and the other 0, showing to behind it.
+type Wipe struct {
+	DX, DY int
+	// Soft is the width of the blended edge in pixels.
+	Soft float64
+}
+
+// Frame implements Effect.
+func (w Wipe) Frame(dst, from, to *image.RGBA, t float64) {
+	r := dst.Rect
+	length := float64(r.Dx())
+	if w.DY != 0 {
+		length = float64(r.Dy())
+	}
+	soft := math.Max(w.Soft, 1)
+	edge := t * (length + soft)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			// distance of the pixel from the side the wipe starts at
+			var pos float64
+			switch {
+			case w.DX > 0:
+				pos = float64(x - r.Min.X)
+			case w.DX < 0:
+				pos = float64(r.Max.X - 1 - x)
+			case w.DY > 0:
+				pos = float64(y - r.Min.Y)
+			default:
+				pos = float64(r.Max.Y - 1 - y)
+			}
+			i := dst.PixOffset(x, y)
+			mix(dst.Pix[i:i+4], from.Pix[i:i+4], to.Pix[i:i+4], (edge-pos)/soft)
+		}
+	}
+}
+
+// Dissolve switches the pixels to the new frame one by one in random
+// order.
+type Dissolve struct {
+	rank []int
+}
+
+// Frame implements Effect.
+func (d *Dissolve) Frame(dst, from, to *image.RGBA, t float64) {
+	n := dst.Rect.Dx() * dst.Rect.Dy()
+	if t == 0 || len(d.rank) != n {
+		d.rank = rand.Perm(n)
+	}
+	limit := int(t * float64(n))
+	for i, rank := range d.rank {
+		src := from.Pix
+		if rank < limit {
+			src = to.Pix
+		}
+		copy(dst.Pix[i*4:i*4+4], src[i*4:i*4+4])
+	}
+}
+
+// Zoom lets the new frame grow out of the center while the old one
+// zooms past the viewer.
+var Zoom = EffectFunc(func(dst, from, to *image.RGBA, t float64) {
+	r := dst.Rect
+	cx, cy := float64(r.Min.X+r.Max.X-1)/2, float64(r.Min.Y+r.Max.Y-1)/2
+	inner, outer := math.Max(t, 1e-6), 1+2*t
+	sample := func(img *image.RGBA, x, y, scale float64) ([]uint8, bool) {
+		p := image.Pt(int(math.Round(cx+(x-cx)/scale)), int(math.Round(cy+(y-cy)/scale)))
+		if !p.In(img.Rect) {
+			return nil, false
+		}
+		i := img.PixOffset(p.X, p.Y)
+		return img.Pix[i : i+4], true
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			i := dst.PixOffset(x, y)
+			if px, ok := sample(to, float64(x), float64(y), inner); ok {
+				copy(dst.Pix[i:i+4], px)
+				continue
+			}
+			px, _ := sample(from, float64(x), float64(y), outer)
+			// fades out while it zooms
+			for c := 0; c < 4; c++ {
+				dst.Pix[i+c] = uint8(float64(px[c]) * (1 - t))
+			}
+		}
+	}
+})
+
+// mix sets dst to from and to mixed at t, pixel by pixel.
+func mix(dst, from, to []uint8, t float64) {
+	t = math.Max(0, math.Min(1, t))
+	f := uint32(t * 256)
+	for i := range dst {
+		dst[i] = uint8((uint32(from[i])*(256-f) + uint32(to[i])*f) >> 8)
+	}
+}
+
+var names = []string{"none", "crossfade", "wipe-left", "wipe-right", "wipe-up", "wipe-down", "dissolve", "life", "zoom", "random"}
+
+// Parse returns the effect called name: none, crossfade, wipe-left,
+// wipe-right, wipe-up, wipe-down, dissolve, life, zoom or random.
+func Parse(name string) (Effect, error) {
+	switch strings.ToLower(name) {
+	case "none", "cut", "":
+		return Cut, nil
+	case "crossfade", "fade":
+		return Crossfade, nil
+	case "wipe-left":
+		return Wipe{DX: -1, Soft: 8}, nil
+	case "wipe-right", "wipe":
+		return Wipe{DX: 1, Soft: 8}, nil
+	case "wipe-up":
+		return Wipe{DY: -1, Soft: 8}, nil
+	case "wipe-down":
+		return Wipe{DY: 1, Soft: 8}, nil
+	case "dissolve":
+		return &Dissolve{}, nil
+	case "life":
+		return &Life{}, nil
+	case "zoom":
+		return Zoom, nil
+	case "random":
+		return &Random{}, nil
+	}
+	return nil, fmt.Errorf("unknown transition %q, use one of %s", name, strings.Join(names, ", "))
+}
+
+// Random picks one of the other effects for every transition.
+type Random struct {
+	effect Effect
+}
+
+// Frame implements Effect.
+func (r *Random) Frame(dst, from, to *image.RGBA, t float64) {
+	if t == 0 || r.effect == nil {
+		// all but none and random itself
+		r.effect, _ = Parse(names[1+rand.Intn(len(names)-2)])
+	}
+	r.effect.Frame(dst, from, to, t)
+}
+
+// Play runs the transition from from to to for d, calling show with
+// every frame, fps times a second, and stops at the first error show
+// returns. dst is reused for all frames, the last one is to. A nil from
+// is taken as black.
+func Play(e Effect, from, to *image.RGBA, d time.Duration, fps int, show func(frame *image.RGBA) error) error {
+	dst := image.NewRGBA(to.Rect)
+	if from == nil {
+		from = image.NewRGBA(to.Rect)
+	}
+	if from.Rect != to.Rect {
+		// same size for the effects, anything outside is black
+		f := image.NewRGBA(to.Rect)
+		draw.Draw(f, from.Rect, from, from.Rect.Min, draw.Src)
+		from = f
+	}
+	frames := int(d.Seconds() * float64(max(fps, 1)))
+	start := time.Now()
+	for i := 0; i < frames; i++ {
+		e.Frame(dst, from, to, float64(i)/float64(frames))
+		if err := show(dst); err != nil {
+			return err
+		}
+		if wait := time.Until(start.Add(time.Duration(i+1) * d / time.Duration(frames))); wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+	copy(dst.Pix, to.Pix)
+	return show(dst)
+}